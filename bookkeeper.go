@@ -1,19 +1,35 @@
 package bookkeeper
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"math"
 	"math/rand"
 	"path"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/chrisxrepo/bookkeeper-client-go/pb"
+	"github.com/go-zookeeper/zk"
 )
 
 type BookKeeper struct {
 	cfg        *Config
 	zk         *Zookeeper
 	clientPool *ClientPool
+	lock       sync.Mutex
+	closed     bool
+	ledgers    map[*normalLedger]struct{} // writable handles
+	placement  EnsemblePlacementPolicy
+	quarantine *quarantine
+	done       chan struct{}
+	wg         sync.WaitGroup
+
+	// metadata can't be changed safely until a new session is established
+	sessionExpired atomic.Bool
 }
 
 func NewBookeeper(cfg *Config) (*BookKeeper, error) {
@@ -26,12 +42,130 @@ func NewBookeeper(cfg *Config) (*BookKeeper, error) {
 		return nil, err
 	}
 
-	return &BookKeeper{cfg: cfg, zk: zk, clientPool: NewClientPool(cfg)}, nil
+	return newBookKeeper(cfg, zk, NewClientPool(cfg)), nil
+}
+
+func newBookKeeper(cfg *Config, zk *Zookeeper, clientPool *ClientPool) *BookKeeper {
+	b := &BookKeeper{
+		cfg:        cfg,
+		zk:         zk,
+		clientPool: clientPool,
+		ledgers:    make(map[*normalLedger]struct{}),
+		placement:  cfg.placementPolicy(),
+		quarantine: newQuarantine(cfg.bookieQuarantineTime()),
+		done:       make(chan struct{}),
+	}
+	b.sessionExpired.Store(zk.SessionExpired())
+	zk.WatchSession(b.sessionExpired.Store)
+
+	clusterChanged := func(_, _ []string) {
+		b.placement.OnClusterChanged(b.writableBookies(), zk.ReadOnlyBookies())
+	}
+	zk.WatchBookies(clusterChanged)
+	zk.WatchReadOnlyBookies(clusterChanged)
+	clusterChanged(nil, nil)
+
+	if aware, ok := b.placement.(BookieInfoAware); ok {
+		refresh := make(chan struct{}, 1)
+		zk.WatchBookies(func(joined, _ []string) {
+			if len(joined) == 0 {
+				return
+			}
+			select {
+			case refresh <- struct{}{}:
+			default:
+			}
+		})
+
+		b.wg.Add(1)
+		go b.sampleBookieInfo(aware, refresh)
+	}
+	return b
 }
 
-func (b *BookKeeper) CreateLeadger(ensSize, writeQuorumSize, ackQuorumSize int, password []byte, digestType pb.LedgerMetadataFormat_DigestType) (Ledger, error) {
-	if ensSize > len(b.zk.Bookies()) {
-		return nil, errors.New("Not enough non-faulty bookies available")
+// Close stop the client, new operations fail with ErrClientClosed. Pending
+// entries are waited until ctx is done, then failed with ErrClientClosed.
+// Ledgers are not closed, they can be recovered by other clients.
+func (b *BookKeeper) Close(ctx context.Context) error {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return nil
+	}
+	b.closed = true
+	ledgers := b.ledgers
+	b.ledgers = nil
+	b.lock.Unlock()
+
+	var err error
+	for ledger := range ledgers {
+		if werr := ledger.waitPendingAdds(ctx); werr != nil {
+			err = werr
+		}
+		ledger.failPendingAdds(ErrClientClosed)
+	}
+
+	// pending bookie info requests fail once the pool is closed
+	close(b.done)
+	b.clientPool.Close()
+	b.wg.Wait()
+	b.zk.Close()
+	return err
+}
+
+// WatchBookies register listener notified when bookies join or leave the
+// cluster, the returned function removes the listener
+func (b *BookKeeper) WatchBookies(listener BookieListener) (cancel func()) {
+	return b.zk.WatchBookies(listener)
+}
+
+// checkMetadataWritable fail fast while the zookeeper session is expired, the
+// operation can be retried once a new session is established
+func (b *BookKeeper) checkMetadataWritable() error {
+	if b.sessionExpired.Load() {
+		return ErrSessionExpired
+	}
+	return nil
+}
+
+func (b *BookKeeper) isClosed() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.closed
+}
+
+// addLedger track the writable handle, its pending entries are drained on close
+func (b *BookKeeper) addLedger(ledger *normalLedger) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		return ErrClientClosed
+	}
+	b.ledgers[ledger] = struct{}{}
+	return nil
+}
+
+func (b *BookKeeper) removeLedger(ledger *normalLedger) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	delete(b.ledgers, ledger)
+}
+
+func (b *BookKeeper) CreateLeadger(ctx context.Context, ensSize, writeQuorumSize, ackQuorumSize int, password []byte, digestType pb.LedgerMetadataFormat_DigestType) (Ledger, error) {
+	return b.CreateLedgerWithFlags(ctx, ensSize, writeQuorumSize, ackQuorumSize, password, digestType, 0)
+}
+
+// CreateLedgerWithFlags create ledger adding entries with flags, entries of a
+// ledger with WriteFlagDeferredSync are persisted by Ledger.Force, and a
+// failed bookie fails the ledger as the ensemble can't be changed
+func (b *BookKeeper) CreateLedgerWithFlags(ctx context.Context, ensSize, writeQuorumSize, ackQuorumSize int, password []byte, digestType pb.LedgerMetadataFormat_DigestType, flags WriteFlag) (Ledger, error) {
+	if b.isClosed() {
+		return nil, ErrClientClosed
+	}
+	if err := b.checkMetadataWritable(); err != nil {
+		return nil, err
 	}
 
 	ensemble, err := b.newEnsemble(ensSize, writeQuorumSize, ackQuorumSize)
@@ -39,7 +173,7 @@ func (b *BookKeeper) CreateLeadger(ensSize, writeQuorumSize, ackQuorumSize int,
 		return nil, err
 	}
 
-	ledgerID, err := b.genLedgerID()
+	ledgerID, err := b.genLedgerID(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -60,24 +194,216 @@ func (b *BookKeeper) CreateLeadger(ensSize, writeQuorumSize, ackQuorumSize int,
 		return nil, err
 	}
 
-	if err := b.zk.SetData(getLedgerPath(ledgerID), data); err != nil {
+	if err := b.zk.SetData(ctx, getLedgerPath(ledgerID), data); err != nil {
+		return nil, err
+	}
+
+	ledger, err := newNormalLedger(b, metadata)
+	if err != nil {
+		return nil, err
+	}
+	ledger.(*normalLedger).writeFlags = flags
+	if err := b.addLedger(ledger.(*normalLedger)); err != nil {
+		return nil, err
+	}
+	return ledger, nil
+}
+
+// OpenLedger open the ledger for reading, an open ledger is fenced and
+// recovered, so the writer can't add entries any more
+func (b *BookKeeper) OpenLedger(ctx context.Context, ledgerID int64, password []byte, digestType pb.LedgerMetadataFormat_DigestType) (Ledger, error) {
+	metadata, err := b.openLedgerMetadata(ctx, ledgerID, password, digestType)
+	if err != nil {
 		return nil, err
 	}
 
-	return newNormalLedger(b, metadata)
+	ledger, err := newNormalLedger(b, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata.state != pb.LedgerMetadataFormat_CLOSED {
+		if err := ledger.(*normalLedger).recover(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return ledger, nil
 }
 
+// OpenLedgerNoRecovery open a read only handle without fencing the ledger,
+// the ledger may still be written by another client
+func (b *BookKeeper) OpenLedgerNoRecovery(ctx context.Context, ledgerID int64, password []byte, digestType pb.LedgerMetadataFormat_DigestType) (Ledger, error) {
+	metadata, err := b.openLedgerMetadata(ctx, ledgerID, password, digestType)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger, err := newNormalLedger(b, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger.(*normalLedger).readOnly = true
+	return ledger, nil
+}
+
+func (b *BookKeeper) openLedgerMetadata(ctx context.Context, ledgerID int64, password []byte, digestType pb.LedgerMetadataFormat_DigestType) (*Metadata, error) {
+	if b.isClosed() {
+		return nil, ErrClientClosed
+	}
+	metadata, err := b.readLedgerMetadata(ctx, ledgerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata.password != nil && !BytesEqual(metadata.password, password) {
+		return nil, ErrUnauthorizedAccess
+	}
+	if metadata.digestType != digestType {
+		return nil, fmt.Errorf("%w: ledger digest type %v", ErrDigestMismatch, metadata.digestType)
+	}
+	return metadata, nil
+}
+
+// newEnsemble choose bookies of a new ledger by the placement policy,
+// quarantined bookies are chosen only if there are not enough other bookies
 func (b *BookKeeper) newEnsemble(ensSize, writeQuorumSize, ackQuorumSize int) ([]string, error) {
-	bks := b.zk.Bookies()
-	if ensSize > len(bks) {
-		return nil, errors.New("Not enough bookie node")
+	quarantined := b.quarantine.list()
+	ensemble, err := b.placement.NewEnsemble(ensSize, writeQuorumSize, ackQuorumSize, quarantined)
+	if errors.Is(err, ErrNotEnoughBookies) && len(quarantined) > 0 {
+		ensemble, err = b.placement.NewEnsemble(ensSize, writeQuorumSize, ackQuorumSize, nil)
+	}
+	return ensemble, err
+}
+
+func (b *BookKeeper) readLedgerMetadata(ctx context.Context, ledgerID int64) (*Metadata, error) {
+	data, version, err := b.zk.GetDataVersion(ctx, getLedgerPath(ledgerID))
+	if errors.Is(err, zk.ErrNoNode) {
+		return nil, fmt.Errorf("%w: ledger %d metadata not found", ErrNoSuchLedger, ledgerID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &Metadata{ledgerID: ledgerID, version: version}
+	if err := metadata.Parse(bytes.NewBuffer(data)); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// updateLedgerMetadata write metadata if the znode version not changed since
+// it was read, the version of metadata is updated on success
+func (b *BookKeeper) updateLedgerMetadata(ctx context.Context, metadata *Metadata) error {
+	if err := b.checkMetadataWritable(); err != nil {
+		return err
+	}
+
+	data, err := metadata.Serialize()
+	if err != nil {
+		return err
+	}
+
+	version, err := b.zk.UpdateData(ctx, getLedgerPath(metadata.ledgerID), data, metadata.version)
+	if errors.Is(err, zk.ErrBadVersion) {
+		return ErrMetadataVersionConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	metadata.version = version
+	return nil
+}
+
+// writableBookies return available bookies not in read only mode, a bookie
+// turning read only may be listed in both for a while
+func (b *BookKeeper) writableBookies() []string {
+	var (
+		readOnly = b.zk.ReadOnlyBookies()
+		bookies  = make([]string, 0, len(b.zk.Bookies()))
+	)
+	for _, bookie := range b.zk.Bookies() {
+		if !containsString(readOnly, bookie) {
+			bookies = append(bookies, bookie)
+		}
 	}
+	return bookies
+}
+
+// replaceBookie choose a bookie not in the ensemble by the placement policy
+// to replace the failed bookie at index, which is quarantined
+func (b *BookKeeper) replaceBookie(metadata *Metadata, ensemble []string, index int) (string, error) {
+	var (
+		bookie          = ensemble[index]
+		ensembleSize    = int(metadata.ensembleSize)
+		writeQuorumSize = int(metadata.writeQuorumSize)
+		ackQuorumSize   = int(metadata.ackQuorumSize)
+	)
+	b.quarantine.add(bookie)
+
+	quarantined := b.quarantine.list()
+	replacement, err := b.placement.ReplaceBookie(ensembleSize, writeQuorumSize, ackQuorumSize, ensemble, bookie, quarantined)
+	if errors.Is(err, ErrNotEnoughBookies) && len(quarantined) > 0 {
+		replacement, err = b.placement.ReplaceBookie(ensembleSize, writeQuorumSize, ackQuorumSize, ensemble, bookie, nil)
+	}
+	return replacement, err
+}
+
+// sampleBookieInfo query disk usage of writable bookies for the placement
+// policy every interval, and at once when bookies join
+func (b *BookKeeper) sampleBookieInfo(aware BookieInfoAware, refresh <-chan struct{}) {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.cfg.bookieInfoInterval())
+	defer ticker.Stop()
+	for {
+		b.updateBookieInfo(aware)
 
-	return bks[0:ensSize], nil
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		case <-refresh:
+		}
+	}
+}
+
+func (b *BookKeeper) updateBookieInfo(aware BookieInfoAware) {
+	var (
+		ctx    = context.Background()
+		logger = b.cfg.logger()
+		flags  = int64(pb.GetBookieInfoRequest_TOTAL_DISK_CAPACITY | pb.GetBookieInfoRequest_FREE_DISK_SPACE)
+		wg     sync.WaitGroup
+	)
+	for _, bookie := range b.writableBookies() {
+		wg.Add(1)
+		go func(bookie string) {
+			defer wg.Done()
+
+			var info BookieInfo
+			client, err := b.clientPool.GetClient(ctx, bookie, -1)
+			if err == nil {
+				info, err = client.GetBookieInfo(ctx, flags)
+			}
+			if errors.Is(err, ErrClientClosed) {
+				return
+			}
+			if err != nil {
+				logger.Warn("get bookie info failed", "bookie", bookie, "error", err)
+				return
+			}
+
+			logger.Debug("bookie info", "bookie", bookie, "totalDiskCapacity", info.TotalDiskCapacity,
+				"freeDiskSpace", info.FreeDiskSpace)
+			aware.UpdateBookieInfo(bookie, info)
+		}(bookie)
+	}
+	wg.Wait()
 }
 
-func (b *BookKeeper) genLedgerID() (int64, error) {
-	return b.zk.LedgerID()
+func (b *BookKeeper) genLedgerID(ctx context.Context) (int64, error) {
+	return b.zk.LedgerID(ctx)
 }
 
 func getLedgerPath(ledger int64) string {
@@ -1,11 +1,16 @@
 package bookkeeper
 
 import (
+	"context"
+	"fmt"
 	"math"
+	"path"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/chrisxrepo/bookkeeper-client-go/pb"
+	"github.com/go-zookeeper/zk"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -24,6 +29,153 @@ func TestCreateLedger(t *testing.T) {
 	})
 	assert.NoError(t, err)
 
-	_, err = bk.CreateLeadger(3, 2, 2, []byte(""), pb.LedgerMetadataFormat_DUMMY)
+	_, err = bk.CreateLeadger(context.Background(), 3, 2, 2, []byte(""), pb.LedgerMetadataFormat_DUMMY)
 	assert.NoError(t, err)
 }
+
+func testBookies(n int) []string {
+	bookies := make([]string, n)
+	for i := range bookies {
+		bookies[i] = fmt.Sprintf("127.0.0.1:%d", 8000+i)
+	}
+	return bookies
+}
+
+// newTestBookKeeper return BookKeeper on memory zookeeper with mock clients,
+// bookies are placed in the order they are listed
+func newTestBookKeeper(t *testing.T, bookieNum int, client funcClient) *BookKeeper {
+	return newTestBookKeeperConfig(t, &Config{PlacementPolicy: newOrderedPlacementPolicy()}, bookieNum, client)
+}
+
+func newTestBookKeeperConfig(t *testing.T, cfg *Config, bookieNum int, client funcClient) *BookKeeper {
+	cfg.ClientNumPreBookie = 1
+	pool := NewClientPool(cfg)
+	pool.clientNew = func(_ context.Context, _ *Config, addr string) (Client, error) {
+		c := client
+		c.addr = addr
+		return &c, nil
+	}
+
+	zk, _ := newMemoryZookeeper(testBookies(bookieNum)...)
+	return newBookKeeper(cfg, zk, pool)
+}
+
+func TestBookKeeper_Close(t *testing.T) {
+	release := make(chan struct{})
+	bk := newTestBookKeeper(t, 3, funcClient{add: func(addr string, entryID int64, _ []byte) error {
+		if entryID > 0 {
+			<-release
+		}
+		return nil
+	}})
+	defer close(release)
+
+	ledger, err := bk.CreateLeadger(context.Background(), 3, 2, 2, nil, pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+	assert.NoError(t, ledger.AddEntry(context.Background(), []byte("hello")))
+
+	failed := make(chan error, 1)
+	ledger.AsyncAddEntry(context.Background(), []byte("hello"), func(entryID int64, err error) {
+		failed <- err
+	})
+
+	// the pending entry is failed once the drain timeout elapsed
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, bk.Close(ctx), context.DeadlineExceeded)
+	assert.ErrorIs(t, <-failed, ErrClientClosed)
+	assert.Equal(t, int64(0), ledger.GetLastAddConfirmed())
+
+	assert.ErrorIs(t, ledger.AddEntry(context.Background(), []byte("hello")), ErrClientClosed)
+	_, err = bk.CreateLeadger(context.Background(), 3, 2, 2, nil, pb.LedgerMetadataFormat_CRC32)
+	assert.ErrorIs(t, err, ErrClientClosed)
+	_, err = bk.OpenLedger(context.Background(), ledger.GetLedgerID(), nil, pb.LedgerMetadataFormat_CRC32)
+	assert.ErrorIs(t, err, ErrClientClosed)
+	assert.NoError(t, bk.Close(context.Background()))
+}
+
+func TestBookKeeper_CloseDrain(t *testing.T) {
+	bk := newTestBookKeeper(t, 3, funcClient{add: func(addr string, entryID int64, _ []byte) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}})
+
+	ledger, err := bk.CreateLeadger(context.Background(), 3, 2, 2, nil, pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		ledger.AsyncAddEntry(context.Background(), []byte("hello"), func(entryID int64, err error) {
+			defer wg.Done()
+			assert.NoError(t, err)
+		})
+	}
+
+	assert.NoError(t, bk.Close(context.Background()))
+	wg.Wait()
+	assert.Equal(t, int64(9), ledger.GetLastAddConfirmed())
+}
+
+func TestBookKeeper_ReadOnlyBookies(t *testing.T) {
+	bookies := newMemoryBookies()
+	bk := newTestBookKeeper(t, 4, funcClient{add: bookies.add, read: bookies.read})
+	bk.zk.setReadOnlyBookies([]string{"127.0.0.1:8000"})
+
+	// read only bookies are excluded from new ensembles and replacements
+	ensemble, err := bk.newEnsemble(3, 2, 2)
+	assert.NoError(t, err)
+	assert.NotContains(t, ensemble, "127.0.0.1:8000")
+	_, err = bk.newEnsemble(4, 2, 2)
+	assert.ErrorIs(t, err, ErrNotEnoughBookies)
+	_, err = bk.replaceBookie(&Metadata{ensembleSize: 3, writeQuorumSize: 2, ackQuorumSize: 2}, ensemble, 0)
+	assert.ErrorIs(t, err, ErrNotEnoughBookies)
+
+	// reads still use a bookie of the ensemble turned read only
+	ledger, err := bk.CreateLeadger(context.Background(), 3, 3, 3, nil, pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+	assert.NoError(t, ledger.AddEntry(context.Background(), []byte("hello")))
+
+	bk.zk.setReadOnlyBookies([]string{ensemble[0], ensemble[1]})
+	entries, err := ledger.ReadEntries(context.Background(), 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), entries[0].Data)
+}
+
+func TestBookKeeper_SessionExpired(t *testing.T) {
+	conn := newMemoryZk()
+	for _, bookie := range testBookies(3) {
+		conn.Create(path.Join("/ledgers/available", bookie), nil, 0, nil)
+	}
+	evCh := make(chan zk.Event, 1)
+	z, err := newZookeeper(conn, evCh, "/ledgers", nopLogger{})
+	assert.NoError(t, err)
+
+	cfg := &Config{ClientNumPreBookie: 1}
+	pool := NewClientPool(cfg)
+	pool.clientNew = func(_ context.Context, _ *Config, addr string) (Client, error) {
+		return &funcClient{addr: addr}, nil
+	}
+	bk := newBookKeeper(cfg, z, pool)
+	defer bk.Close(context.Background())
+
+	ledger, err := bk.CreateLeadger(context.Background(), 3, 2, 2, nil, pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+	assert.NoError(t, ledger.AddEntry(context.Background(), []byte("hello")))
+
+	evCh <- zk.Event{Type: zk.EventSession, State: zk.StateExpired}
+	assert.Eventually(t, func() bool { return bk.sessionExpired.Load() }, time.Second, time.Millisecond)
+
+	_, err = bk.CreateLeadger(context.Background(), 3, 2, 2, nil, pb.LedgerMetadataFormat_CRC32)
+	assert.ErrorIs(t, err, ErrSessionExpired)
+	assert.True(t, IsRetriable(err))
+
+	// entries are still written, the metadata is not changed
+	assert.NoError(t, ledger.AddEntry(context.Background(), []byte("hello")))
+	assert.ErrorIs(t, ledger.Close(context.Background()), ErrSessionExpired)
+
+	evCh <- zk.Event{Type: zk.EventSession, State: zk.StateHasSession}
+	assert.Eventually(t, func() bool { return !bk.sessionExpired.Load() }, time.Second, time.Millisecond)
+	assert.NoError(t, ledger.Close(context.Background()))
+	assert.Equal(t, int64(1), ledger.GetLastAddConfirmed())
+}
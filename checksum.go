@@ -20,6 +20,16 @@ type Checksum interface {
 	// package sending data
 	PackageForSending(entryID, lastAddConfirmed, length int64, data []byte) ([]byte, error)
 
+	// verify the frame read from bookie, return the payload and the last add
+	// confirmed and length piggybacked in the frame
+	VerifyDigestAndReturnData(entryID int64, frame []byte) (data []byte, lastAddConfirmed, length int64, err error)
+
+	// package last add confirmed for explicit lac
+	PackageForSendingLac(lastAddConfirmed int64) ([]byte, error)
+
+	// verify the explicit lac frame read from bookie, return the last add confirmed
+	VerifyDigestAndReturnLac(frame []byte) (int64, error)
+
 	getChecksumLength() int
 
 	writeChecksum(buffer *bytes.Buffer, bss ...[]byte)
@@ -75,6 +85,76 @@ func (d *defaultChecksum) PackageForSending(entryID, lastAddConfirmed, length in
 	return buffer.Bytes(), nil
 }
 
+func (d *defaultChecksum) VerifyDigestAndReturnData(entryID int64, frame []byte) ([]byte, int64, int64, error) {
+	var checksumLength = d.mgr.getChecksumLength()
+	if len(frame) < _METADATA_LENGTH+checksumLength {
+		return nil, 0, 0, &DigestError{LedgerID: d.ledgerID, EntryID: entryID, Err: ErrShortFrame}
+	}
+
+	var (
+		header   = frame[:_METADATA_LENGTH]
+		expected = frame[_METADATA_LENGTH : _METADATA_LENGTH+checksumLength]
+		data     = frame[_METADATA_LENGTH+checksumLength:]
+		buffer   = bytes.NewBuffer(make([]byte, 0, checksumLength))
+	)
+	d.mgr.writeChecksum(buffer, header, data)
+	if !BytesEqual(buffer.Bytes(), expected) {
+		return nil, 0, 0, &DigestError{LedgerID: d.ledgerID, EntryID: entryID, Err: ErrDigestMismatch}
+	}
+
+	if ledgerID := int64(binary.BigEndian.Uint64(header[0:8])); ledgerID != d.ledgerID {
+		return nil, 0, 0, &DigestError{LedgerID: ledgerID, EntryID: entryID, Err: ErrLedgerIDMismatch}
+	}
+	if id := int64(binary.BigEndian.Uint64(header[8:16])); id != entryID {
+		return nil, 0, 0, &DigestError{LedgerID: d.ledgerID, EntryID: id, Err: ErrEntryIDMismatch}
+	}
+
+	var (
+		lastAddConfirmed = int64(binary.BigEndian.Uint64(header[16:24]))
+		length           = int64(binary.BigEndian.Uint64(header[24:32]))
+	)
+	return data, lastAddConfirmed, length, nil
+}
+
+func (d *defaultChecksum) PackageForSendingLac(lastAddConfirmed int64) ([]byte, error) {
+	var buffer = bytes.NewBuffer(make([]byte, 0, _LAC_METADATA_LENGTH+d.mgr.getChecksumLength()))
+	binary.Write(buffer, binary.BigEndian, d.ledgerID)
+	binary.Write(buffer, binary.BigEndian, lastAddConfirmed)
+
+	d.mgr.writeChecksum(buffer, buffer.Bytes())
+	return buffer.Bytes(), nil
+}
+
+func (d *defaultChecksum) VerifyDigestAndReturnLac(frame []byte) (int64, error) {
+	var checksumLength = d.mgr.getChecksumLength()
+	if len(frame) < _LAC_METADATA_LENGTH+checksumLength {
+		return 0, &DigestError{LedgerID: d.ledgerID, EntryID: -1, Err: ErrShortFrame}
+	}
+
+	var (
+		header   = frame[:_LAC_METADATA_LENGTH]
+		expected = frame[_LAC_METADATA_LENGTH : _LAC_METADATA_LENGTH+checksumLength]
+		buffer   = bytes.NewBuffer(make([]byte, 0, checksumLength))
+	)
+	d.mgr.writeChecksum(buffer, header)
+	if !BytesEqual(buffer.Bytes(), expected) {
+		return 0, &DigestError{LedgerID: d.ledgerID, EntryID: -1, Err: ErrDigestMismatch}
+	}
+
+	if ledgerID := int64(binary.BigEndian.Uint64(header[0:8])); ledgerID != d.ledgerID {
+		return 0, &DigestError{LedgerID: ledgerID, EntryID: -1, Err: ErrLedgerIDMismatch}
+	}
+	return int64(binary.BigEndian.Uint64(header[8:16])), nil
+}
+
+// frameEntryID return the entry id in the frame header, -1 for short frame
+func frameEntryID(frame []byte) int64 {
+	if len(frame) < _METADATA_LENGTH {
+		return -1
+	}
+	return int64(binary.BigEndian.Uint64(frame[8:16]))
+}
+
 // DummyChecksum digest manager for dummy
 type DummyChecksum struct {
 	*defaultChecksum
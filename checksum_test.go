@@ -34,3 +34,75 @@ func TestChecksum_HMAC(t *testing.T) {
 	c.writeChecksum(buffer, []byte("abce"), []byte("edfh"))
 	assert.Equal(t, buffer.Len(), c.getChecksumLength())
 }
+
+func TestChecksum_VerifyDigest(t *testing.T) {
+	digestTypes := []pb.LedgerMetadataFormat_DigestType{
+		pb.LedgerMetadataFormat_CRC32,
+		pb.LedgerMetadataFormat_CRC32C,
+		pb.LedgerMetadataFormat_HMAC,
+		pb.LedgerMetadataFormat_DUMMY,
+	}
+
+	for _, digestType := range digestTypes {
+		c, err := NewChecksum(10, []byte("password"), digestType)
+		assert.NoError(t, err)
+
+		frame, err := c.PackageForSending(5, 4, 100, []byte("hello"))
+		assert.NoError(t, err)
+
+		data, lac, length, err := c.VerifyDigestAndReturnData(5, frame)
+		assert.NoError(t, err, digestType)
+		assert.Equal(t, []byte("hello"), data)
+		assert.Equal(t, int64(4), lac)
+		assert.Equal(t, int64(100), length)
+
+		_, _, _, err = c.VerifyDigestAndReturnData(6, frame)
+		assert.ErrorIs(t, err, ErrEntryIDMismatch, digestType)
+
+		_, _, _, err = c.VerifyDigestAndReturnData(5, frame[:10])
+		assert.ErrorIs(t, err, ErrShortFrame, digestType)
+
+		other, err := NewChecksum(11, []byte("password"), digestType)
+		assert.NoError(t, err)
+		_, _, _, err = other.VerifyDigestAndReturnData(5, frame)
+		assert.ErrorIs(t, err, ErrLedgerIDMismatch, digestType)
+
+		if digestType != pb.LedgerMetadataFormat_DUMMY {
+			corrupted := append([]byte{}, frame...)
+			corrupted[len(corrupted)-1] ^= 0xff
+			_, _, _, err = c.VerifyDigestAndReturnData(5, corrupted)
+			assert.ErrorIs(t, err, ErrDigestMismatch, digestType)
+
+			var digestErr *DigestError
+			assert.ErrorAs(t, err, &digestErr)
+			assert.Equal(t, int64(5), digestErr.EntryID)
+		}
+	}
+}
+
+func TestChecksum_VerifyLac(t *testing.T) {
+	digestTypes := []pb.LedgerMetadataFormat_DigestType{
+		pb.LedgerMetadataFormat_CRC32,
+		pb.LedgerMetadataFormat_CRC32C,
+		pb.LedgerMetadataFormat_HMAC,
+		pb.LedgerMetadataFormat_DUMMY,
+	}
+
+	for _, digestType := range digestTypes {
+		c, err := NewChecksum(10, []byte("password"), digestType)
+		assert.NoError(t, err)
+
+		frame, err := c.PackageForSendingLac(99)
+		assert.NoError(t, err)
+
+		lac, err := c.VerifyDigestAndReturnLac(frame)
+		assert.NoError(t, err, digestType)
+		assert.Equal(t, int64(99), lac)
+
+		if digestType != pb.LedgerMetadataFormat_DUMMY {
+			frame[10] ^= 0xff
+			_, err = c.VerifyDigestAndReturnLac(frame)
+			assert.ErrorIs(t, err, ErrDigestMismatch, digestType)
+		}
+	}
+}
@@ -2,10 +2,10 @@ package bookkeeper
 
 import (
 	"bufio"
-	"encoding/binary"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
+	"math"
 	"math/rand"
 	"net"
 	"sync"
@@ -22,9 +22,81 @@ var (
 	txnIdGenerator        = atomic.Uint64{}
 )
 
+// ConnState is the state of the connection to a bookie
+type ConnState int32
+
+const (
+	// ConnConnecting is dialing the bookie, requests wait the dial
+	ConnConnecting ConnState = iota
+	// ConnReady is connected, requests are sent to the bookie
+	ConnReady
+	// ConnFailed is waiting backoff after a failed dial, requests fail fast
+	ConnFailed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnConnecting:
+		return "connecting"
+	case ConnReady:
+		return "ready"
+	case ConnFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// WriteFlag is the bitset of flags of adding an entry
+type WriteFlag int32
+
+const (
+	// WriteFlagDeferredSync let the bookie acknowledge the entry before the
+	// journal is synced, the entry is persisted by ForceLedger
+	WriteFlagDeferredSync WriteFlag = 1
+)
+
 type Client interface {
 	Remote() string
-	AddEntry(ledgerID, entryID int64, mastKey []byte, payload []byte) error
+
+	// State return the state of the connection
+	State() ConnState
+
+	// Close close the connection, requests fail with ErrClientClosed
+	Close() error
+
+	AddEntry(ctx context.Context, ledgerID, entryID int64, mastKey []byte, payload []byte, flags WriteFlag) error
+	ReadEntry(ctx context.Context, ledgerID, entryID int64) ([]byte, error)
+
+	// RecoveryAddEntry add entry to a fenced ledger while recovering it
+	RecoveryAddEntry(ctx context.Context, ledgerID, entryID int64, mastKey []byte, payload []byte) error
+
+	// FenceReadEntry read entry and fence the ledger, entryID -1 read the
+	// last entry of the ledger on the bookie, return the entry id of the
+	// response, which is the requested id as the bookie echoes it
+	FenceReadEntry(ctx context.Context, ledgerID, entryID int64, mastKey []byte) (int64, []byte, error)
+
+	// ReadLAC return the explicit lac frame and the last entry on the bookie
+	ReadLAC(ctx context.Context, ledgerID int64) (lacBody []byte, lastEntryBody []byte, err error)
+
+	// LongPollReadEntry wait at most timeout on bookie until the lac goes beyond
+	// previousLAC, return the lac and the entry previousLAC+1 if piggyback is
+	// set and the entry exists on the bookie
+	LongPollReadEntry(ctx context.Context, ledgerID, previousLAC int64, timeout time.Duration, piggyback bool) (int64, []byte, error)
+
+	// GetBookieInfo return the disk usage of the bookie, flags is the bitwise
+	// OR of pb.GetBookieInfoRequest_Flags to request
+	GetBookieInfo(ctx context.Context, flags int64) (BookieInfo, error)
+
+	// ForceLedger wait the entries of the ledger added with deferred sync are
+	// persisted on the bookie
+	ForceLedger(ctx context.Context, ledgerID int64) error
+}
+
+// BookieInfo is the disk usage of a bookie in bytes, the fields not requested
+// are zero
+type BookieInfo struct {
+	TotalDiskCapacity int64
+	FreeDiskSpace     int64
 }
 
 type emptyClient struct{}
@@ -33,33 +105,78 @@ func (c emptyClient) Remote() string {
 	return ""
 }
 
-func (c emptyClient) AddEntry(ledgerID, entryID int64, mastKey []byte, payload []byte) error {
+func (c emptyClient) State() ConnState {
+	return ConnReady
+}
+
+func (c emptyClient) Close() error {
+	return nil
+}
+
+func (c emptyClient) AddEntry(ctx context.Context, ledgerID, entryID int64, mastKey []byte, payload []byte, flags WriteFlag) error {
+	return nil
+}
+
+func (c emptyClient) ReadEntry(ctx context.Context, ledgerID, entryID int64) ([]byte, error) {
+	return nil, nil
+}
+
+func (c emptyClient) RecoveryAddEntry(ctx context.Context, ledgerID, entryID int64, mastKey []byte, payload []byte) error {
+	return nil
+}
+
+func (c emptyClient) FenceReadEntry(ctx context.Context, ledgerID, entryID int64, mastKey []byte) (int64, []byte, error) {
+	return entryID, nil, nil
+}
+
+func (c emptyClient) ReadLAC(ctx context.Context, ledgerID int64) ([]byte, []byte, error) {
+	return nil, nil, nil
+}
+
+func (c emptyClient) LongPollReadEntry(ctx context.Context, ledgerID, previousLAC int64, timeout time.Duration, piggyback bool) (int64, []byte, error) {
+	return previousLAC, nil, nil
+}
+
+func (c emptyClient) GetBookieInfo(ctx context.Context, flags int64) (BookieInfo, error) {
+	return BookieInfo{}, nil
+}
+
+func (c emptyClient) ForceLedger(ctx context.Context, ledgerID int64) error {
 	return nil
 }
 
 type ClientPool struct {
 	cfg        *Config
-	clientNew  func(*Config, string) (Client, error)
+	clientNew  func(context.Context, *Config, string) (Client, error)
 	clientMap  sync.Map //map[string][]Client
 	clientLock sync.Mutex
+	closed     bool
 }
 
 func NewClientPool(cfg *Config) *ClientPool {
 	return &ClientPool{
 		cfg:       cfg,
-		clientNew: newClient,
+		clientNew: connectClient,
 	}
 }
 
-func (p *ClientPool) GetClient(addr string, ledgerID int64) (Client, error) {
+func (p *ClientPool) GetClient(ctx context.Context, addr string, ledgerID int64) (Client, error) {
 	value, ok := p.clientMap.Load(addr)
 	if !ok {
 		p.clientLock.Lock()
+		if p.closed {
+			p.clientLock.Unlock()
+			return nil, ErrClientClosed
+		}
 		if value, ok = p.clientMap.Load(addr); !ok {
-			clients := make([]Client, p.cfg.ClientNumPreBookie)
-			for i := 0; i < p.cfg.ClientNumPreBookie; i++ {
-				client, err := p.clientNew(p.cfg, addr)
+			clients := make([]Client, p.cfg.clientNumPerBookie())
+			for i := range clients {
+				client, err := p.clientNew(ctx, p.cfg, addr)
 				if err != nil {
+					p.clientLock.Unlock()
+					for _, client := range clients[:i] {
+						client.Close()
+					}
 					return nil, err
 				}
 				clients[i] = client
@@ -70,33 +187,115 @@ func (p *ClientPool) GetClient(addr string, ledgerID int64) (Client, error) {
 		p.clientLock.Unlock()
 	}
 
-	clients := value.([]Client)
-	return clients[rand.Intn(p.cfg.ClientNumPreBookie)], nil
+	// prefer a ready client, the others are reconnecting
+	var (
+		clients = value.([]Client)
+		start   = rand.Intn(len(clients))
+	)
+	for i := range clients {
+		if client := clients[(start+i)%len(clients)]; client.State() == ConnReady {
+			return client, nil
+		}
+	}
+	return clients[start], nil
+}
+
+// Close close all pooled clients, the pool can't create clients any more
+func (p *ClientPool) Close() error {
+	p.clientLock.Lock()
+	p.closed = true
+	p.clientLock.Unlock()
+
+	p.clientMap.Range(func(addr, value any) bool {
+		for _, client := range value.([]Client) {
+			client.Close()
+		}
+		p.clientMap.Delete(addr)
+		return true
+	})
+	return nil
+}
+
+// State return the best state of connections to the bookie, false if no
+// client of the bookie has been created
+func (p *ClientPool) State(addr string) (ConnState, bool) {
+	value, ok := p.clientMap.Load(addr)
+	if !ok {
+		return ConnConnecting, false
+	}
+
+	state := ConnFailed
+	for _, client := range value.([]Client) {
+		switch client.State() {
+		case ConnReady:
+			return ConnReady, true
+		case ConnConnecting:
+			state = ConnConnecting
+		}
+	}
+	return state, true
 }
 
 type bookieClient struct {
-	cfg  *Config
-	addr string
-	conn net.Conn
-	in   *bufio.Reader
-	out  *bufio.Writer
+	cfg    *Config
+	logger Logger
+	addr   string
+	conn   net.Conn
+	out    *bufio.Writer
+
+	writeLock   sync.Mutex
+	pendingLock sync.Mutex
+	pending     map[uint64]*pendingRequest
+	state       ConnState
+	closed      bool
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+
+	// stateChanged is closed and replaced on every state change
+	stateChanged chan struct{}
+}
+
+type pendingRequest struct {
+	resp *pb.Response
+	err  error
+	done chan struct{}
+}
+
+func newBookieClient(cfg *Config, addr string) *bookieClient {
+	c := &bookieClient{
+		cfg:     cfg,
+		logger:  cfg.logger(),
+		addr:    addr,
+		pending: make(map[uint64]*pendingRequest),
+		state:   ConnConnecting,
+
+		stateChanged: make(chan struct{}),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c
 }
 
-func newClient(cfg *Config, addr string) (Client, error) {
-	conn, err := net.Dial("tcp", addr)
+// newClient dial the bookie and return the connected client
+func newClient(ctx context.Context, cfg *Config, addr string) (Client, error) {
+	c := newBookieClient(cfg, addr)
+	conn, err := c.dial(ctx)
 	if err != nil {
+		c.cancel()
 		return nil, err
 	}
 
-	c := &bookieClient{
-		cfg:  cfg,
-		addr: addr,
-		conn: conn,
-		in:   bufio.NewReaderSize(conn, 4096),
-		out:  bufio.NewWriterSize(conn, 4096),
-	}
+	c.setConn(conn)
+	return c, nil
+}
 
-	go c.connRead()
+// connectClient return the client dialing the bookie in background, so it
+// never blocks the pool, a failed dial is retried with backoff as a lost
+// connection is
+func connectClient(_ context.Context, cfg *Config, addr string) (Client, error) {
+	c := newBookieClient(cfg, addr)
+	c.wg.Add(1)
+	go c.reconnect()
 	return c, nil
 }
 
@@ -104,70 +303,456 @@ func (c *bookieClient) Remote() string {
 	return c.addr
 }
 
-func (c *bookieClient) AddEntry(ledgerID, entryID int64, mastKey []byte, payload []byte) error {
-	var (
-		version   = pb.ProtocolVersion_VERSION_THREE
-		operation = pb.OperationType_ADD_ENTRY
-		txnID     = txnIdGenerator.Add(1)
-	)
+func (c *bookieClient) State() ConnState {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	return c.state
+}
+
+// Close fail in-flight requests with ErrClientClosed, close the connection
+// and wait the reading and reconnecting goroutines to exit
+func (c *bookieClient) Close() error {
+	c.pendingLock.Lock()
+	if c.closed {
+		c.pendingLock.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.setStateLocked(ConnFailed)
+	pending := c.pending
+	c.pending = make(map[uint64]*pendingRequest)
+	// conn is set holding both locks, it's closed without the write lock so
+	// a blocked write is interrupted
+	conn := c.conn
+	c.pendingLock.Unlock()
+
+	c.cancel()
+	for _, pr := range pending {
+		pr.err = ErrClientClosed
+		close(pr.done)
+	}
+	if conn != nil {
+		conn.Close()
+	}
+
+	c.wg.Wait()
+	return nil
+}
+
+func (c *bookieClient) dial(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.connectTimeout())
+	defer cancel()
+	return (&net.Dialer{}).DialContext(ctx, "tcp", c.addr)
+}
+
+// setConn switch to the new connection and start reading responses from it,
+// the connection is dropped if the client has been closed
+func (c *bookieClient) setConn(conn net.Conn) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+
+	if c.closed {
+		conn.Close()
+		return
+	}
+	c.conn = conn
+	c.out = bufio.NewWriterSize(conn, 4096)
+	c.setStateLocked(ConnReady)
+
+	c.wg.Add(1)
+	go c.connRead(conn, bufio.NewReaderSize(conn, 4096))
+}
+
+// connLost fail in-flight requests of the broken connection and reconnect
+func (c *bookieClient) connLost(conn net.Conn, err error) {
+	conn.Close()
+
+	c.pendingLock.Lock()
+	if c.closed {
+		c.pendingLock.Unlock()
+		return
+	}
+	pending := c.pending
+	c.pending = make(map[uint64]*pendingRequest)
+	c.setStateLocked(ConnConnecting)
+	c.wg.Add(1)
+	c.pendingLock.Unlock()
+
+	c.logger.Warn("bookie connection lost", "bookie", c.addr, "pending", len(pending), "error", err)
+
+	for _, pr := range pending {
+		pr.err = err
+		close(pr.done)
+	}
+
+	go c.reconnect()
+}
+
+// reconnect dial the bookie until success or the client closed, the delay
+// between attempts grows exponentially with jitter, so restarted bookies are
+// not flooded
+func (c *bookieClient) reconnect() {
+	defer c.wg.Done()
+
+	backoff := c.cfg.reconnectBackoff()
+	for {
+		c.setState(ConnConnecting)
+		conn, err := c.dial(c.ctx)
+		if err == nil {
+			c.logger.Info("bookie reconnected", "bookie", c.addr)
+			c.setConn(conn)
+			return
+		}
+
+		c.setState(ConnFailed)
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		c.logger.Warn("reconnect bookie failed", "bookie", c.addr, "retryAfter", wait, "error", err)
+		delay := time.NewTimer(wait)
+		select {
+		case <-delay.C:
+		case <-c.ctx.Done():
+			delay.Stop()
+			return
+		}
+		if backoff *= 2; backoff > c.cfg.maxReconnectBackoff() {
+			backoff = c.cfg.maxReconnectBackoff()
+		}
+	}
+}
+
+func (c *bookieClient) setState(state ConnState) {
+	c.pendingLock.Lock()
+	if !c.closed && c.state != state {
+		c.setStateLocked(state)
+	}
+	c.pendingLock.Unlock()
+}
+
+// setStateLocked change the state and wake requests waiting the dial, it's
+// called holding pendingLock
+func (c *bookieClient) setStateLocked(state ConnState) {
+	c.state = state
+	close(c.stateChanged)
+	c.stateChanged = make(chan struct{})
+}
 
-	req := &pb.Request{
+func (c *bookieClient) AddEntry(ctx context.Context, ledgerID, entryID int64, mastKey []byte, payload []byte, flags WriteFlag) error {
+	return c.addEntry(ctx, newAddRequest(ledgerID, entryID, mastKey, payload, flags))
+}
+
+func newAddRequest(ledgerID, entryID int64, mastKey []byte, payload []byte, flags WriteFlag) *pb.AddRequest {
+	addReq := &pb.AddRequest{
+		LedgerId:  &ledgerID,
+		EntryId:   &entryID,
+		MasterKey: mastKey,
+		Body:      payload,
+	}
+	if flags != 0 {
+		addReq.WriteFlags = proto.Int32(int32(flags))
+	}
+	return addReq
+}
+
+// addRequestSize return the max encoded size of the request adding payload,
+// it's checked against Config.MaxFrameSize before the entry is sent
+func addRequestSize(ledgerID, entryID int64, mastKey []byte, payload []byte, flags WriteFlag) int {
+	return proto.Size(&pb.Request{
 		Header: &pb.BKPacketHeader{
-			Version:   &version,
-			Operation: &operation,
-			TxnId:     &txnID,
-		},
-		AddRequest: &pb.AddRequest{
-			LedgerId:  &ledgerID,
-			EntryId:   &entryID,
-			MasterKey: mastKey,
-			Body:      payload,
+			Version:   pb.ProtocolVersion_VERSION_THREE.Enum(),
+			Operation: pb.OperationType_ADD_ENTRY.Enum(),
+			TxnId:     proto.Uint64(math.MaxUint64),
 		},
+		AddRequest: newAddRequest(ledgerID, entryID, mastKey, payload, flags),
+	})
+}
+
+func (c *bookieClient) RecoveryAddEntry(ctx context.Context, ledgerID, entryID int64, mastKey []byte, payload []byte) error {
+	return c.addEntry(ctx, &pb.AddRequest{
+		Flag:      pb.AddRequest_RECOVERY_ADD.Enum(),
+		LedgerId:  &ledgerID,
+		EntryId:   &entryID,
+		MasterKey: mastKey,
+		Body:      payload,
+	})
+}
+
+func (c *bookieClient) ReadEntry(ctx context.Context, ledgerID, entryID int64) ([]byte, error) {
+	resp, err := c.readEntry(ctx, &pb.ReadRequest{
+		LedgerId: &ledgerID,
+		EntryId:  &entryID,
+	})
+	if err != nil {
+		return nil, err
 	}
+	return resp.GetBody(), nil
+}
 
-	buffer := make([]byte, 4, proto.Size(req)+4)
-	out, err := proto.MarshalOptions{}.MarshalAppend(buffer, req)
+func (c *bookieClient) FenceReadEntry(ctx context.Context, ledgerID, entryID int64, mastKey []byte) (int64, []byte, error) {
+	resp, err := c.readEntry(ctx, &pb.ReadRequest{
+		Flag:      pb.ReadRequest_FENCE_LEDGER.Enum(),
+		LedgerId:  &ledgerID,
+		EntryId:   &entryID,
+		MasterKey: mastKey,
+	})
 	if err != nil {
-		return err
+		return 0, nil, err
 	}
-	binary.BigEndian.PutUint32(out[:4], uint32(len(out)-4))
+	return resp.GetEntryId(), resp.GetBody(), nil
+}
 
-	if _, err = c.out.Write(out); err != nil {
-		return err
+func (c *bookieClient) ReadLAC(ctx context.Context, ledgerID int64) ([]byte, []byte, error) {
+	resp, err := c.sendRequest(ctx, &pb.Request{
+		Header:         newPacketHeader(pb.OperationType_READ_LAC),
+		ReadLacRequest: &pb.ReadLacRequest{LedgerId: &ledgerID},
+	}, c.cfg.readEntryTimeout())
+	if err != nil {
+		return nil, nil, c.requestError(ledgerID, -1, err)
+	}
+	if err := c.responseError(ledgerID, -1, resp.GetStatus(), resp.GetReadLacResponse().GetStatus()); err != nil {
+		return nil, nil, err
 	}
-	return c.out.Flush()
+	return resp.GetReadLacResponse().GetLacBody(), resp.GetReadLacResponse().GetLastEntryBody(), nil
 }
 
-func (c *bookieClient) connRead() {
-	for {
-		lengthBuf, err := c.in.Peek(4)
-		if err != nil {
-			fmt.Println("peek error:", err)
-			return
+func (c *bookieClient) LongPollReadEntry(ctx context.Context, ledgerID, previousLAC int64, timeout time.Duration, piggyback bool) (int64, []byte, error) {
+	// the request is for entry -1, the bookie reads the piggybacked entry
+	// previousLAC+1 by itself and rejects other entry ids
+	var (
+		timeoutMs = timeout.Milliseconds()
+		entryID   = int64(-1)
+	)
+	readReq := &pb.ReadRequest{
+		LedgerId:    &ledgerID,
+		EntryId:     proto.Int64(-1),
+		PreviousLAC: &previousLAC,
+		TimeOut:     &timeoutMs,
+	}
+	if piggyback {
+		readReq.Flag = pb.ReadRequest_ENTRY_PIGGYBACK.Enum()
+		entryID = previousLAC + 1
+	}
+
+	// the bookie holds the request until the lac changes or timeout
+	resp, err := c.sendRequest(ctx, &pb.Request{
+		Header:      newPacketHeader(pb.OperationType_READ_ENTRY),
+		ReadRequest: readReq,
+	}, timeout+c.cfg.readEntryTimeout())
+	if err != nil {
+		return 0, nil, c.requestError(ledgerID, entryID, err)
+	}
+
+	// the status of the read response is copied to the response, the lac is
+	// valid even the piggybacked entry is missing
+	readResp := resp.GetReadResponse()
+	if readResp == nil || readResp.GetStatus() != pb.StatusCode_ENOENTRY {
+		if err := c.responseError(ledgerID, entryID, resp.GetStatus(), readResp.GetStatus()); err != nil {
+			return 0, nil, err
 		}
+	}
+	if readResp == nil || readResp.MaxLAC == nil {
+		// a response without lac must not move the lac of the reader
+		return 0, nil, &BookieError{Bookie: c.addr, LedgerID: ledgerID, EntryID: entryID, Status: readResp.GetStatus(),
+			Err: fmt.Errorf("%w: no lac in long poll response", ErrUnexpectedStatus)}
+	}
+	if readResp.GetStatus() == pb.StatusCode_ENOENTRY {
+		return readResp.GetMaxLAC(), nil, nil
+	}
+	return readResp.GetMaxLAC(), readResp.GetBody(), nil
+}
 
-		length := binary.BigEndian.Uint32(lengthBuf)
-		fmt.Println("-----------length:", length)
+func (c *bookieClient) GetBookieInfo(ctx context.Context, flags int64) (BookieInfo, error) {
+	resp, err := c.sendRequest(ctx, &pb.Request{
+		Header:               newPacketHeader(pb.OperationType_GET_BOOKIE_INFO),
+		GetBookieInfoRequest: &pb.GetBookieInfoRequest{Requested: &flags},
+	}, c.cfg.readEntryTimeout())
+	if err != nil {
+		return BookieInfo{}, c.requestError(-1, -1, err)
+	}
+	infoResp := resp.GetGetBookieInfoResponse()
+	if err := c.responseError(-1, -1, resp.GetStatus(), infoResp.GetStatus()); err != nil {
+		return BookieInfo{}, err
+	}
+	return BookieInfo{
+		TotalDiskCapacity: infoResp.GetTotalDiskCapacity(),
+		FreeDiskSpace:     infoResp.GetFreeDiskSpace(),
+	}, nil
+}
+
+func (c *bookieClient) ForceLedger(ctx context.Context, ledgerID int64) error {
+	resp, err := c.sendRequest(ctx, &pb.Request{
+		Header:             newPacketHeader(pb.OperationType_FORCE_LEDGER),
+		ForceLedgerRequest: &pb.ForceLedgerRequest{LedgerId: &ledgerID},
+	}, c.cfg.addEntryTimeout())
+	if err != nil {
+		return c.requestError(ledgerID, -1, err)
+	}
+	return c.responseError(ledgerID, -1, resp.GetStatus(), resp.GetForceLedgerResponse().GetStatus())
+}
 
-		if c.in.Buffered() < int(length)+4 {
-			time.Sleep(time.Millisecond) //wait incomming data
-			continue
+func (c *bookieClient) addEntry(ctx context.Context, addReq *pb.AddRequest) error {
+	resp, err := c.sendRequest(ctx, &pb.Request{
+		Header:     newPacketHeader(pb.OperationType_ADD_ENTRY),
+		AddRequest: addReq,
+	}, c.cfg.addEntryTimeout())
+	if err != nil {
+		return c.requestError(addReq.GetLedgerId(), addReq.GetEntryId(), err)
+	}
+	return c.responseError(addReq.GetLedgerId(), addReq.GetEntryId(), resp.GetStatus(), resp.GetAddResponse().GetStatus())
+}
+
+func (c *bookieClient) readEntry(ctx context.Context, readReq *pb.ReadRequest) (*pb.ReadResponse, error) {
+	resp, err := c.sendRequest(ctx, &pb.Request{
+		Header:      newPacketHeader(pb.OperationType_READ_ENTRY),
+		ReadRequest: readReq,
+	}, c.cfg.readEntryTimeout())
+	if err != nil {
+		return nil, c.requestError(readReq.GetLedgerId(), readReq.GetEntryId(), err)
+	}
+	if err := c.responseError(readReq.GetLedgerId(), readReq.GetEntryId(), resp.GetStatus(), resp.GetReadResponse().GetStatus()); err != nil {
+		return nil, err
+	}
+	return resp.GetReadResponse(), nil
+}
+
+func (c *bookieClient) requestError(ledgerID, entryID int64, err error) error {
+	return &BookieError{Bookie: c.addr, LedgerID: ledgerID, EntryID: entryID, Err: err}
+}
+
+// responseError return the error of the first status not ok, the status of
+// the response is checked before the status of the sub response
+func (c *bookieClient) responseError(ledgerID, entryID int64, statuses ...pb.StatusCode) error {
+	for _, status := range statuses {
+		if err := statusError(status); err != nil {
+			return &BookieError{Bookie: c.addr, LedgerID: ledgerID, EntryID: entryID, Status: status, Err: err}
 		}
+	}
+	return nil
+}
 
-		buffer := make([]byte, length+4)
-		if _, err := io.ReadFull(c.in, buffer); err != nil {
-			fmt.Println("read error:", err)
-			return
+func newPacketHeader(operation pb.OperationType) *pb.BKPacketHeader {
+	var (
+		version = pb.ProtocolVersion_VERSION_THREE
+		txnID   = txnIdGenerator.Add(1)
+	)
+	return &pb.BKPacketHeader{
+		Version:   &version,
+		Operation: &operation,
+		TxnId:     &txnID,
+	}
+}
+
+// sendRequest write request to bookie and wait the response with the same
+// txnId, the request is removed from the in-flight table once ctx is done or
+// timeout elapsed, the late response is dropped
+func (c *bookieClient) sendRequest(ctx context.Context, req *pb.Request, timeout time.Duration) (*pb.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	txnID := req.GetHeader().GetTxnId()
+	pr := &pendingRequest{done: make(chan struct{})}
+
+	c.pendingLock.Lock()
+	for c.state == ConnConnecting && !c.closed {
+		// wait the dial in progress within the request timeout
+		changed := c.stateChanged
+		c.pendingLock.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		c.pendingLock.Lock()
+	}
+	if c.closed {
+		c.pendingLock.Unlock()
+		return nil, ErrClientClosed
+	}
+	if state := c.state; state != ConnReady {
+		c.pendingLock.Unlock()
+		return nil, fmt.Errorf("%w: %v", ErrBookieUnavailable, state)
+	}
+	c.pending[txnID] = pr
+	c.pendingLock.Unlock()
+
+	if err := c.writeRequest(req); err != nil {
+		c.completeRequest(txnID, nil, err)
+	}
+
+	select {
+	case <-pr.done:
+	case <-ctx.Done():
+		// the response may be completed at the same time, pr.done is closed
+		// either way
+		c.completeRequest(txnID, nil, ctx.Err())
+		<-pr.done
+		if errors.Is(pr.err, context.DeadlineExceeded) {
+			c.logger.Warn("bookie request timeout", "bookie", c.addr, "txnId", txnID,
+				"operation", req.GetHeader().GetOperation(), "timeout", timeout)
+		}
+	}
+	return pr.resp, pr.err
+}
+
+func (c *bookieClient) writeRequest(req *pb.Request) error {
+	frame, err := marshalFrame(req, c.cfg.maxFrameSize())
+	if err != nil {
+		return err
+	}
+	defer releaseFrame(frame)
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if _, err = c.out.Write(*frame); err != nil {
+		c.conn.Close()
+		return err
+	}
+	if err = c.out.Flush(); err != nil {
+		// the reader notices the closed connection and reconnects
+		c.conn.Close()
+	}
+	return err
+}
+
+func (c *bookieClient) completeRequest(txnID uint64, resp *pb.Response, err error) {
+	c.pendingLock.Lock()
+	pr, ok := c.pending[txnID]
+	delete(c.pending, txnID)
+	c.pendingLock.Unlock()
+
+	if !ok {
+		if resp != nil {
+			// the request has timed out or the connection has been reset
+			c.logger.Debug("drop response of unknown request", "bookie", c.addr, "txnId", txnID)
 		}
+		return
+	}
+	pr.resp, pr.err = resp, err
+	close(pr.done)
+}
+
+func (c *bookieClient) connRead(conn net.Conn, in *bufio.Reader) {
+	defer c.wg.Done()
 
-		var resp pb.Response
-		if err := proto.Unmarshal(buffer[4:], &resp); err != nil {
-			fmt.Println("proto unmarshal error:", err)
+	reader := newFrameReader(in, c.cfg.maxFrameSize())
+	for {
+		frame, err := reader.readFrame()
+		if err != nil {
+			c.connLost(conn, err)
 			return
 		}
 
-		out, err := json.Marshal(resp)
-		fmt.Println(string(out), err)
+		// the response doesn't alias the frame, the buffer can be reused
+		resp := &pb.Response{}
+		if err := proto.Unmarshal(frame, resp); err != nil {
+			c.logger.Error("decode bookie response failed", "bookie", c.addr, "error", err)
+			c.connLost(conn, err)
+			return
+		}
 
+		c.completeRequest(resp.GetHeader().GetTxnId(), resp, nil)
 	}
 }
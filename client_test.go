@@ -1,21 +1,37 @@
 package bookkeeper
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/chrisxrepo/bookkeeper-client-go/pb"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
 )
 
 type mockClient struct {
 	emptyClient
-	addr string
+	addr   string
+	closed bool
+}
+
+func (c *mockClient) Close() error {
+	c.closed = true
+	return nil
 }
 
 func (c *mockClient) Remote() string {
 	return c.addr
 }
 
-func newMockClient(_ *Config, addr string) (Client, error) {
+func newMockClient(_ context.Context, _ *Config, addr string) (Client, error) {
 	return &mockClient{addr: addr}, nil
 }
 
@@ -23,11 +39,586 @@ func TestPoolGetClient(t *testing.T) {
 	pool := NewClientPool(&Config{ClientNumPreBookie: 3})
 	pool.clientNew = newMockClient
 
-	c, err := pool.GetClient("127.0.0.1:8000", 1)
+	c, err := pool.GetClient(context.Background(), "127.0.0.1:8000", 1)
 	assert.NoError(t, err)
 	assert.Equal(t, c.Remote(), "127.0.0.1:8000")
 
 	value, ok := pool.clientMap.Load("127.0.0.1:8000")
 	assert.True(t, ok)
 	assert.Equal(t, len(value.([]Client)), pool.cfg.ClientNumPreBookie)
+
+	// one client per bookie by default
+	pool = NewClientPool(&Config{})
+	pool.clientNew = newMockClient
+	_, err = pool.GetClient(context.Background(), "127.0.0.1:8000", 1)
+	assert.NoError(t, err)
+	value, _ = pool.clientMap.Load("127.0.0.1:8000")
+	assert.Len(t, value.([]Client), 1)
+}
+
+// newMockBookie start a tcp server which answer every request by handler
+func newMockBookie(t *testing.T, handler func(*pb.Request) *pb.Response) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+
+			go func() {
+				var writeLock sync.Mutex
+				for {
+					var lengthBuf [4]byte
+					if _, err := io.ReadFull(conn, lengthBuf[:]); err != nil {
+						return
+					}
+					buffer := make([]byte, binary.BigEndian.Uint32(lengthBuf[:]))
+					if _, err := io.ReadFull(conn, buffer); err != nil {
+						return
+					}
+
+					req := &pb.Request{}
+					if err := proto.Unmarshal(buffer, req); err != nil {
+						return
+					}
+
+					go func() {
+						resp := handler(req)
+						if resp == nil {
+							return
+						}
+						out, _ := proto.MarshalOptions{}.MarshalAppend(make([]byte, 4), resp)
+						binary.BigEndian.PutUint32(out[:4], uint32(len(out)-4))
+
+						writeLock.Lock()
+						defer writeLock.Unlock()
+						conn.Write(out)
+					}()
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func addResponse(req *pb.Request, status pb.StatusCode) *pb.Response {
+	return &pb.Response{
+		Header: req.Header,
+		Status: pb.StatusCode_EOK.Enum(),
+		AddResponse: &pb.AddResponse{
+			Status:   status.Enum(),
+			LedgerId: req.AddRequest.LedgerId,
+			EntryId:  req.AddRequest.EntryId,
+		},
+	}
+}
+
+func TestBookieClient_AddEntry(t *testing.T) {
+	addr := newMockBookie(t, func(req *pb.Request) *pb.Response {
+		if req.GetAddRequest().GetEntryId()%2 == 1 {
+			return addResponse(req, pb.StatusCode_EFENCED)
+		}
+		// reply out of order, even entries complete later than odd entries
+		time.Sleep(10 * time.Millisecond)
+		return addResponse(req, pb.StatusCode_EOK)
+	})
+
+	c, err := newClient(context.Background(), &Config{}, addr)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(entryID int64) {
+			defer wg.Done()
+			err := c.AddEntry(context.Background(), 1, entryID, []byte("key"), []byte("data"), 0)
+			if entryID%2 == 1 {
+				var bookieErr *BookieError
+				assert.ErrorIs(t, err, ErrLedgerFenced)
+				assert.ErrorAs(t, err, &bookieErr)
+				assert.Equal(t, addr, bookieErr.Bookie)
+				assert.Equal(t, entryID, bookieErr.EntryID)
+			} else {
+				assert.NoError(t, err)
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+}
+
+func TestBookieClient_AddEntryWriteFlags(t *testing.T) {
+	addr := newMockBookie(t, func(req *pb.Request) *pb.Response {
+		if req.GetAddRequest().GetWriteFlags() != int32(req.GetAddRequest().GetEntryId()) {
+			return addResponse(req, pb.StatusCode_EBADREQ)
+		}
+		if req.GetAddRequest().GetEntryId() == 0 && req.GetAddRequest().WriteFlags != nil {
+			return addResponse(req, pb.StatusCode_EBADREQ)
+		}
+		return addResponse(req, pb.StatusCode_EOK)
+	})
+
+	c, err := newClient(context.Background(), &Config{}, addr)
+	assert.NoError(t, err)
+
+	// the entry id is the expected flags, no flags are sent by default
+	assert.NoError(t, c.AddEntry(context.Background(), 1, 0, []byte("key"), []byte("data"), 0))
+	assert.NoError(t, c.AddEntry(context.Background(), 1, 1, []byte("key"), []byte("data"), WriteFlagDeferredSync))
+}
+
+func TestBookieClient_ConnectionLost(t *testing.T) {
+	addr := newMockBookie(t, func(req *pb.Request) *pb.Response {
+		if req.GetAddRequest().GetEntryId() == 0 {
+			return nil
+		}
+		return addResponse(req, pb.StatusCode_EOK)
+	})
+
+	c, err := newClient(context.Background(), &Config{ReconnectBackoff: time.Millisecond}, addr)
+	assert.NoError(t, err)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c.(*bookieClient).conn.Close()
+	}()
+
+	// the in-flight request fails, the client reconnects
+	err = c.AddEntry(context.Background(), 1, 0, []byte("key"), []byte("data"), 0)
+	assert.Error(t, err)
+
+	assert.Eventually(t, func() bool { return c.State() == ConnReady }, time.Second, time.Millisecond)
+	assert.NoError(t, c.AddEntry(context.Background(), 1, 1, []byte("key"), []byte("data"), 0))
+}
+
+func TestBookieClient_Reconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	c, err := newClient(context.Background(), &Config{ReconnectBackoff: time.Millisecond, MaxReconnectBackoff: 10 * time.Millisecond}, addr)
+	assert.NoError(t, err)
+	assert.Equal(t, ConnReady, c.State())
+
+	// the bookie goes down, requests fail fast while it's unreachable
+	ln.Close()
+	(<-accepted).Close()
+	assert.Eventually(t, func() bool { return c.State() == ConnFailed }, time.Second, time.Millisecond)
+
+	err = c.AddEntry(context.Background(), 1, 0, []byte("key"), []byte("data"), 0)
+	assert.ErrorIs(t, err, ErrBookieUnavailable)
+	assert.True(t, IsRetriable(err))
+
+	// the bookie restarts on the same address
+	ln, err = net.Listen("tcp", addr)
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	assert.Eventually(t, func() bool { return c.State() == ConnReady }, time.Second, time.Millisecond)
+}
+
+func TestPoolState(t *testing.T) {
+	pool := NewClientPool(&Config{ClientNumPreBookie: 2})
+	pool.clientNew = newMockClient
+
+	_, ok := pool.State("127.0.0.1:8000")
+	assert.False(t, ok)
+
+	_, err := pool.GetClient(context.Background(), "127.0.0.1:8000", 1)
+	assert.NoError(t, err)
+
+	state, ok := pool.State("127.0.0.1:8000")
+	assert.True(t, ok)
+	assert.Equal(t, ConnReady, state)
+}
+
+func TestBookieClient_ReadEntry(t *testing.T) {
+	addr := newMockBookie(t, func(req *pb.Request) *pb.Response {
+		status := pb.StatusCode_EOK
+		if req.GetReadRequest().GetEntryId() > 0 {
+			status = pb.StatusCode_ENOENTRY
+		}
+		return &pb.Response{
+			Header: req.Header,
+			Status: pb.StatusCode_EOK.Enum(),
+			ReadResponse: &pb.ReadResponse{
+				Status:   status.Enum(),
+				LedgerId: req.ReadRequest.LedgerId,
+				EntryId:  req.ReadRequest.EntryId,
+				Body:     []byte("data"),
+			},
+		}
+	})
+
+	c, err := newClient(context.Background(), &Config{}, addr)
+	assert.NoError(t, err)
+
+	body, err := c.ReadEntry(context.Background(), 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), body)
+
+	_, err = c.ReadEntry(context.Background(), 1, 1)
+	assert.ErrorIs(t, err, ErrNoSuchEntry)
+}
+
+func TestBookieClient_ReadLargeEntry(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), 500*1024)
+	addr := newMockBookie(t, func(req *pb.Request) *pb.Response {
+		return &pb.Response{
+			Header: req.Header,
+			Status: pb.StatusCode_EOK.Enum(),
+			ReadResponse: &pb.ReadResponse{
+				Status:   pb.StatusCode_EOK.Enum(),
+				LedgerId: req.ReadRequest.LedgerId,
+				EntryId:  req.ReadRequest.EntryId,
+				Body:     large,
+			},
+		}
+	})
+
+	c, err := newClient(context.Background(), &Config{}, addr)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		body, err := c.ReadEntry(context.Background(), 1, int64(i))
+		assert.NoError(t, err)
+		assert.Equal(t, large, body)
+	}
+
+	// a response over the max frame size breaks the connection
+	c, err = newClient(context.Background(), &Config{MaxFrameSize: 1024}, addr)
+	assert.NoError(t, err)
+	_, err = c.ReadEntry(context.Background(), 1, 0)
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+}
+
+func TestBookieClient_ReadLAC(t *testing.T) {
+	addr := newMockBookie(t, func(req *pb.Request) *pb.Response {
+		return &pb.Response{
+			Header: req.Header,
+			Status: pb.StatusCode_EOK.Enum(),
+			ReadLacResponse: &pb.ReadLacResponse{
+				Status:        pb.StatusCode_EOK.Enum(),
+				LedgerId:      req.ReadLacRequest.LedgerId,
+				LacBody:       []byte("lac"),
+				LastEntryBody: []byte("entry"),
+			},
+		}
+	})
+
+	c, err := newClient(context.Background(), &Config{}, addr)
+	assert.NoError(t, err)
+
+	lacBody, lastEntryBody, err := c.ReadLAC(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("lac"), lacBody)
+	assert.Equal(t, []byte("entry"), lastEntryBody)
+}
+
+func TestBookieClient_GetBookieInfo(t *testing.T) {
+	addr := newMockBookie(t, func(req *pb.Request) *pb.Response {
+		resp := &pb.Response{
+			Header:                req.Header,
+			Status:                pb.StatusCode_EOK.Enum(),
+			GetBookieInfoResponse: &pb.GetBookieInfoResponse{Status: pb.StatusCode_EOK.Enum()},
+		}
+		requested := req.GetBookieInfoRequest.GetRequested()
+		if requested&int64(pb.GetBookieInfoRequest_TOTAL_DISK_CAPACITY) != 0 {
+			resp.GetBookieInfoResponse.TotalDiskCapacity = proto.Int64(1000)
+		}
+		if requested&int64(pb.GetBookieInfoRequest_FREE_DISK_SPACE) != 0 {
+			resp.GetBookieInfoResponse.FreeDiskSpace = proto.Int64(400)
+		}
+		if requested == 0 {
+			resp.GetBookieInfoResponse.Status = pb.StatusCode_EBADREQ.Enum()
+		}
+		return resp
+	})
+
+	c, err := newClient(context.Background(), &Config{}, addr)
+	assert.NoError(t, err)
+
+	flags := int64(pb.GetBookieInfoRequest_TOTAL_DISK_CAPACITY | pb.GetBookieInfoRequest_FREE_DISK_SPACE)
+	info, err := c.GetBookieInfo(context.Background(), flags)
+	assert.NoError(t, err)
+	assert.Equal(t, BookieInfo{TotalDiskCapacity: 1000, FreeDiskSpace: 400}, info)
+
+	info, err = c.GetBookieInfo(context.Background(), int64(pb.GetBookieInfoRequest_FREE_DISK_SPACE))
+	assert.NoError(t, err)
+	assert.Equal(t, BookieInfo{FreeDiskSpace: 400}, info)
+
+	_, err = c.GetBookieInfo(context.Background(), 0)
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
+
+func TestBookieClient_ForceLedger(t *testing.T) {
+	addr := newMockBookie(t, func(req *pb.Request) *pb.Response {
+		status := pb.StatusCode_EOK
+		if req.ForceLedgerRequest.GetLedgerId() != 1 {
+			status = pb.StatusCode_ENOLEDGER
+		}
+		return &pb.Response{
+			Header: req.Header,
+			Status: pb.StatusCode_EOK.Enum(),
+			ForceLedgerResponse: &pb.ForceLedgerResponse{
+				Status:   status.Enum(),
+				LedgerId: req.ForceLedgerRequest.LedgerId,
+			},
+		}
+	})
+
+	c, err := newClient(context.Background(), &Config{}, addr)
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.ForceLedger(context.Background(), 1))
+
+	err = c.ForceLedger(context.Background(), 2)
+	assert.ErrorIs(t, err, ErrNoSuchLedger)
+	var bookieErr *BookieError
+	assert.ErrorAs(t, err, &bookieErr)
+	assert.Equal(t, int64(2), bookieErr.LedgerID)
+	assert.Equal(t, pb.StatusCode_ENOLEDGER, bookieErr.Status)
+}
+
+// longPollBookie answer long poll reads as a bookie does, the piggybacked
+// entry previousLAC+1 is read by the bookie for the request of entry -1, and
+// the status of the read response is copied to the response
+func longPollBookie(t *testing.T, lac int64, entries map[int64][]byte) string {
+	return newMockBookie(t, func(req *pb.Request) *pb.Response {
+		readReq := req.GetReadRequest()
+		resp := &pb.ReadResponse{
+			Status:   pb.StatusCode_EOK.Enum(),
+			LedgerId: readReq.LedgerId,
+			EntryId:  readReq.EntryId,
+			MaxLAC:   proto.Int64(lac),
+		}
+		switch {
+		case readReq.GetEntryId() != -1:
+			resp.Status, resp.MaxLAC = pb.StatusCode_EBADREQ.Enum(), nil
+		case readReq.GetFlag() != pb.ReadRequest_ENTRY_PIGGYBACK:
+		case lac <= readReq.GetPreviousLAC() || entries[readReq.GetPreviousLAC()+1] == nil:
+			resp.Status = pb.StatusCode_ENOENTRY.Enum()
+		default:
+			resp.EntryId = proto.Int64(readReq.GetPreviousLAC() + 1)
+			resp.Body = entries[readReq.GetPreviousLAC()+1]
+		}
+		return &pb.Response{Header: req.Header, Status: resp.Status, ReadResponse: resp}
+	})
+}
+
+func TestBookieClient_LongPollReadEntry(t *testing.T) {
+	addr := longPollBookie(t, 6, map[int64][]byte{5: []byte("data")})
+	c, err := newClient(context.Background(), &Config{}, addr)
+	assert.NoError(t, err)
+
+	lac, body, err := c.LongPollReadEntry(context.Background(), 1, 4, time.Second, true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), lac)
+	assert.Equal(t, []byte("data"), body)
+
+	lac, body, err = c.LongPollReadEntry(context.Background(), 1, 4, time.Second, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), lac)
+	assert.Nil(t, body)
+
+	// the lac moved but the bookie misses the entry, the lac is still valid
+	lac, body, err = c.LongPollReadEntry(context.Background(), 1, 5, time.Second, true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), lac)
+	assert.Nil(t, body)
+
+	// the lac didn't move before timeout
+	lac, body, err = c.LongPollReadEntry(context.Background(), 1, 6, time.Second, true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), lac)
+	assert.Nil(t, body)
+}
+
+func TestBookieClient_LongPollReadEntryNoLAC(t *testing.T) {
+	addr := newMockBookie(t, func(req *pb.Request) *pb.Response {
+		resp := &pb.Response{Header: req.Header, Status: pb.StatusCode_EOK.Enum()}
+		if req.GetReadRequest().GetFlag() == pb.ReadRequest_ENTRY_PIGGYBACK {
+			readReq := req.GetReadRequest()
+			resp.ReadResponse = &pb.ReadResponse{
+				Status:   pb.StatusCode_EOK.Enum(),
+				LedgerId: readReq.LedgerId,
+				EntryId:  readReq.EntryId,
+				Body:     []byte("data"),
+			}
+		}
+		return resp
+	})
+
+	c, err := newClient(context.Background(), &Config{}, addr)
+	assert.NoError(t, err)
+
+	// neither a response without lac nor a missing read response move the lac
+	_, _, err = c.LongPollReadEntry(context.Background(), 1, 4, time.Second, true)
+	assert.ErrorIs(t, err, ErrUnexpectedStatus)
+	var bookieErr *BookieError
+	assert.ErrorAs(t, err, &bookieErr)
+	assert.Equal(t, int64(5), bookieErr.EntryID)
+
+	_, _, err = c.LongPollReadEntry(context.Background(), 1, 4, time.Second, false)
+	assert.ErrorIs(t, err, ErrUnexpectedStatus)
+}
+
+func TestBookieClient_RequestTimeout(t *testing.T) {
+	addr := newMockBookie(t, func(req *pb.Request) *pb.Response { return nil })
+
+	c, err := newClient(context.Background(), &Config{AddEntryTimeout: 20 * time.Millisecond}, addr)
+	assert.NoError(t, err)
+
+	err = c.AddEntry(context.Background(), 1, 0, []byte("key"), []byte("data"), 0)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, IsRetriable(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err = c.ReadEntry(ctx, 1, 0)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	bc := c.(*bookieClient)
+	bc.pendingLock.Lock()
+	assert.Empty(t, bc.pending)
+	bc.pendingLock.Unlock()
+}
+
+func TestBookieClient_Close(t *testing.T) {
+	addr := newMockBookie(t, func(req *pb.Request) *pb.Response { return nil })
+
+	c, err := newClient(context.Background(), &Config{}, addr)
+	assert.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.AddEntry(context.Background(), 1, 0, []byte("key"), []byte("data"), 0)
+	}()
+	assert.Eventually(t, func() bool {
+		bc := c.(*bookieClient)
+		bc.pendingLock.Lock()
+		defer bc.pendingLock.Unlock()
+		return len(bc.pending) == 1
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, c.Close())
+	assert.ErrorIs(t, <-done, ErrClientClosed)
+	assert.ErrorIs(t, c.AddEntry(context.Background(), 1, 1, []byte("key"), []byte("data"), 0), ErrClientClosed)
+	assert.NoError(t, c.Close())
+}
+
+func TestBookieClient_CloseReconnecting(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			conn.Close()
+		}
+		ln.Close()
+	}()
+
+	c, err := newClient(context.Background(), &Config{ReconnectBackoff: time.Hour}, ln.Addr().String())
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return c.State() == ConnFailed }, time.Second, time.Millisecond)
+
+	// the reconnecting goroutine is waiting the backoff
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("close blocked by reconnecting")
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	pool := NewClientPool(&Config{ClientNumPreBookie: 2})
+	pool.clientNew = newMockClient
+
+	_, err := pool.GetClient(context.Background(), "127.0.0.1:8000", 1)
+	assert.NoError(t, err)
+
+	assert.NoError(t, pool.Close())
+	_, ok := pool.State("127.0.0.1:8000")
+	assert.False(t, ok)
+
+	_, err = pool.GetClient(context.Background(), "127.0.0.1:8000", 1)
+	assert.ErrorIs(t, err, ErrClientClosed)
+}
+
+func TestPoolGetClientDialFailed(t *testing.T) {
+	var built []*mockClient
+	pool := NewClientPool(&Config{ClientNumPreBookie: 3})
+	pool.clientNew = func(_ context.Context, _ *Config, addr string) (Client, error) {
+		if len(built) == 2 {
+			return nil, errors.New("mock dial error")
+		}
+		client := &mockClient{addr: addr}
+		built = append(built, client)
+		return client, nil
+	}
+
+	// the clients built before the failed dial are not leaked
+	_, err := pool.GetClient(context.Background(), "127.0.0.1:8000", 1)
+	assert.Error(t, err)
+	assert.Len(t, built, 2)
+	for _, client := range built {
+		assert.True(t, client.closed)
+	}
+	_, ok := pool.State("127.0.0.1:8000")
+	assert.False(t, ok)
+}
+
+func TestPoolConnect(t *testing.T) {
+	addr := newMockBookie(t, func(req *pb.Request) *pb.Response {
+		return addResponse(req, pb.StatusCode_EOK)
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	down := ln.Addr().String()
+	ln.Close()
+
+	pool := NewClientPool(&Config{ReconnectBackoff: time.Hour})
+	defer pool.Close()
+
+	// the request waits the dial of the new client
+	c, err := pool.GetClient(context.Background(), addr, 1)
+	assert.NoError(t, err)
+	assert.NoError(t, c.AddEntry(context.Background(), 1, 0, []byte("key"), []byte("data"), 0))
+
+	// the client of the bookie down is kept failed, it's not dialed again by
+	// every caller
+	c, err = pool.GetClient(context.Background(), down, 1)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		state, ok := pool.State(down)
+		return ok && state == ConnFailed
+	}, time.Second, time.Millisecond)
+	assert.ErrorIs(t, c.AddEntry(context.Background(), 1, 0, []byte("key"), []byte("data"), 0), ErrBookieUnavailable)
+
+	again, err := pool.GetClient(context.Background(), down, 1)
+	assert.NoError(t, err)
+	assert.Same(t, c, again)
 }
@@ -6,6 +6,21 @@ import (
 
 const (
 	VERSION_THREE = 3
+
+	defaultConnectTimeout   = 10 * time.Second
+	defaultAddEntryTimeout  = 5 * time.Second
+	defaultReadEntryTimeout = 5 * time.Second
+
+	defaultClientNumPerBookie = 1
+	defaultMaxFrameSize       = 5 * 1024 * 1024
+
+	defaultReconnectBackoff    = 100 * time.Millisecond
+	defaultMaxReconnectBackoff = 10 * time.Second
+
+	defaultMaxReadConcurrency = 64
+
+	defaultBookieQuarantineTime = 30 * time.Minute
+	defaultBookieInfoInterval   = time.Hour
 )
 
 type Config struct {
@@ -15,10 +30,134 @@ type Config struct {
 	// zookeeper session timeout
 	ZKTimeout time.Duration
 
-	// number client per
+	// number of connections per bookie, default 1
 	ClientNumPreBookie int
+
+	// timeout of connecting to bookie, default 10s
+	ConnectTimeout time.Duration
+
+	// timeout of adding entry to bookie, the bookie is replaced by ensemble
+	// change on timeout, default 5s
+	AddEntryTimeout time.Duration
+
+	// timeout of reading entry from bookie, default 5s
+	ReadEntryTimeout time.Duration
+
+	// first delay before reconnecting to a bookie, it doubles on every failed
+	// attempt up to MaxReconnectBackoff, default 100ms
+	ReconnectBackoff time.Duration
+
+	// max delay between reconnecting attempts, default 10s
+	MaxReconnectBackoff time.Duration
+
+	// max entries read concurrently by a call of ReadEntries, default 64
+	MaxReadConcurrency int
+
+	// max size of frame sent to or received from bookie, default 5MB as the
+	// bookie's default
+	MaxFrameSize int
+
+	// logger of the client, nothing is logged by default
+	Logger Logger
+
+	// policy choosing bookies of ensembles and the order to read them, a
+	// random policy by default, it must not be shared by BookKeeper instances
+	PlacementPolicy EnsemblePlacementPolicy
+
+	// time a failed bookie is avoided by new ensembles and replacements,
+	// default 30m
+	BookieQuarantineTime time.Duration
+
+	// interval of querying disk usage of bookies for a placement policy
+	// implementing BookieInfoAware, joined bookies are queried at once,
+	// default 1h
+	BookieInfoInterval time.Duration
 }
 
 func (c Config) ValidConfig() error {
 	return nil
 }
+
+func (c *Config) clientNumPerBookie() int {
+	if c.ClientNumPreBookie > 0 {
+		return c.ClientNumPreBookie
+	}
+	return defaultClientNumPerBookie
+}
+
+func (c *Config) connectTimeout() time.Duration {
+	if c.ConnectTimeout > 0 {
+		return c.ConnectTimeout
+	}
+	return defaultConnectTimeout
+}
+
+func (c *Config) addEntryTimeout() time.Duration {
+	if c.AddEntryTimeout > 0 {
+		return c.AddEntryTimeout
+	}
+	return defaultAddEntryTimeout
+}
+
+func (c *Config) readEntryTimeout() time.Duration {
+	if c.ReadEntryTimeout > 0 {
+		return c.ReadEntryTimeout
+	}
+	return defaultReadEntryTimeout
+}
+
+func (c *Config) reconnectBackoff() time.Duration {
+	if c.ReconnectBackoff > 0 {
+		return c.ReconnectBackoff
+	}
+	return defaultReconnectBackoff
+}
+
+func (c *Config) maxReconnectBackoff() time.Duration {
+	if c.MaxReconnectBackoff > 0 {
+		return c.MaxReconnectBackoff
+	}
+	return defaultMaxReconnectBackoff
+}
+
+func (c *Config) maxFrameSize() int {
+	if c.MaxFrameSize > 0 {
+		return c.MaxFrameSize
+	}
+	return defaultMaxFrameSize
+}
+
+func (c *Config) maxReadConcurrency() int {
+	if c.MaxReadConcurrency > 0 {
+		return c.MaxReadConcurrency
+	}
+	return defaultMaxReadConcurrency
+}
+
+func (c *Config) logger() Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return nopLogger{}
+}
+
+func (c *Config) placementPolicy() EnsemblePlacementPolicy {
+	if c.PlacementPolicy != nil {
+		return c.PlacementPolicy
+	}
+	return NewRandomPlacementPolicy()
+}
+
+func (c *Config) bookieQuarantineTime() time.Duration {
+	if c.BookieQuarantineTime > 0 {
+		return c.BookieQuarantineTime
+	}
+	return defaultBookieQuarantineTime
+}
+
+func (c *Config) bookieInfoInterval() time.Duration {
+	if c.BookieInfoInterval > 0 {
+		return c.BookieInfoInterval
+	}
+	return defaultBookieInfoInterval
+}
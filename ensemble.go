@@ -0,0 +1,111 @@
+package bookkeeper
+
+import (
+	"context"
+	"errors"
+)
+
+// changeEnsemble replace the failed bookie with a new one, the new segment
+// starts from the first entry not confirmed, and the pending entries written
+// to the failed bookie are resent to the new one
+func (l *normalLedger) changeEnsemble(index int, bookie string) {
+	l.ensembleLock.Lock()
+	defer l.ensembleLock.Unlock()
+
+	l.entryLock.Lock()
+	var (
+		metadata = l.metadata
+		ensemble = metadata.lastEnsemble()
+	)
+	if l.err != nil || ensemble[index] != bookie {
+		// the ledger failed or the bookie has been replaced already
+		l.entryLock.Unlock()
+		return
+	}
+	if l.writeFlags&WriteFlagDeferredSync != 0 {
+		// the entries not forced may be lost with the failed bookie, and
+		// they are only forced on the last ensemble
+		l.entryLock.Unlock()
+		l.bookkeeper.cfg.logger().Error("ensemble change failed", "ledgerId", l.ledgerID, "bookie", bookie,
+			"error", ErrDeferredSyncNotAllowed)
+		l.failPendingAdds(ErrDeferredSyncNotAllowed)
+		return
+	}
+	l.changingEnsemble = true
+	firstEntryID := l.lastAddConfirmed.Load() + 1
+	l.entryLock.Unlock()
+
+	// the ensemble change is not bound to any caller, the metadata store
+	// operations are bounded by the session timeout
+	ctx := context.Background()
+	logger := l.bookkeeper.cfg.logger()
+	replacement, err := l.bookkeeper.replaceBookie(metadata, ensemble, index)
+	if err != nil {
+		logger.Error("ensemble change failed", "ledgerId", l.ledgerID, "bookie", bookie, "error", err)
+		l.failPendingAdds(err)
+		return
+	}
+
+	newEnsemble := append([]string{}, ensemble...)
+	newEnsemble[index] = replacement
+
+	newMetadata := metadata.clone()
+	newMetadata.ensembles[firstEntryID] = newEnsemble
+	if err := l.bookkeeper.updateLedgerMetadata(ctx, newMetadata); err != nil {
+		if errors.Is(err, ErrMetadataVersionConflict) {
+			// only the writer changes ensembles, the ledger is being recovered
+			err = ErrLedgerFenced
+		}
+		logger.Error("ensemble change failed", "ledgerId", l.ledgerID, "bookie", bookie, "error", err)
+		l.failPendingAdds(err)
+		return
+	}
+	logger.Info("ensemble changed", "ledgerId", l.ledgerID, "firstEntryId", firstEntryID,
+		"bookie", bookie, "replacement", replacement)
+
+	var (
+		writeQuorumSize = int(newMetadata.writeQuorumSize)
+		ensembleSize    = int(newMetadata.ensembleSize)
+		resend          []*pendingAdd
+	)
+	l.entryLock.Lock()
+	l.metadata = newMetadata
+	for _, op := range l.pendingAdds {
+		if op.err != nil || !inWriteSet(op.entryID, index, ensembleSize, writeQuorumSize) {
+			continue
+		}
+
+		// the entry must be on the replacement to match the new metadata
+		delete(op.ackSet, index)
+		op.completed = false
+		resend = append(resend, op)
+	}
+	l.changingEnsemble = false
+	l.entryLock.Unlock()
+
+	for _, op := range resend {
+		l.sendAddEntry(op, index, replacement)
+	}
+	l.sendAddCallbacks()
+}
+
+// failPendingAdds fail all pending entries, the ledger can't be written any more
+func (l *normalLedger) failPendingAdds(err error) {
+	l.entryLock.Lock()
+	if l.err == nil {
+		l.err = &LedgerFailedError{LedgerID: l.ledgerID, Err: err}
+	}
+	l.changingEnsemble = false
+	l.entryLock.Unlock()
+
+	l.sendAddCallbacks()
+}
+
+func inWriteSet(entryID int64, index, ensembleSize, writeQuorumSize int) bool {
+	for _, i := range newWriteSet(entryID, ensembleSize, writeQuorumSize) {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
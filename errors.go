@@ -0,0 +1,149 @@
+package bookkeeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/chrisxrepo/bookkeeper-client-go/pb"
+)
+
+// errors mapped from bookie status codes
+var (
+	ErrNoSuchLedger       = errors.New("No such ledger")
+	ErrNoSuchEntry        = errors.New("No such entry")
+	ErrBadRequest         = errors.New("Bad request")
+	ErrBookieIO           = errors.New("Bookie IO error")
+	ErrUnauthorizedAccess = errors.New("Unauthorized access to ledger")
+	ErrBadVersion         = errors.New("Bad protocol version")
+	ErrLedgerFenced       = errors.New("Ledger fenced")
+	ErrBookieReadOnly     = errors.New("Bookie is read only")
+	ErrTooManyRequests    = errors.New("Too many requests to bookie")
+	ErrUnknownLedgerState = errors.New("Unknown ledger state")
+	ErrUnexpectedStatus   = errors.New("Unexpected bookie status")
+)
+
+// errors of client side
+var (
+	ErrNotEnoughBookies        = errors.New("Not enough bookies available")
+	ErrBookieUnavailable       = errors.New("Bookie connection not ready")
+	ErrClientClosed            = errors.New("BookKeeper client closed")
+	ErrSessionExpired          = errors.New("Zookeeper session expired")
+	ErrLedgerClosed            = errors.New("Ledger closed")
+	ErrReadOnlyLedger          = errors.New("Ledger handle is read only")
+	ErrReadOutOfRange          = errors.New("Read entries out of range")
+	ErrMetadataVersionConflict = errors.New("Ledger metadata changed by another client")
+	ErrInvalidMetadata         = errors.New("Invalid ledger metadata")
+	ErrDigestMismatch          = errors.New("Entry digest mismatch")
+	ErrLedgerIDMismatch        = errors.New("Entry ledger id mismatch")
+	ErrEntryIDMismatch         = errors.New("Entry id mismatch")
+	ErrShortFrame              = errors.New("Entry frame too short")
+	ErrFrameTooLarge           = errors.New("Frame exceeds max frame size")
+	ErrDeferredSyncNotAllowed  = errors.New("Ensemble change not allowed for deferred sync ledger")
+	ErrLedgerFailed            = errors.New("Ledger can't be written any more")
+)
+
+// BookieError is returned by operations on a bookie, it wraps the error
+// mapped from the status code or the transport error
+type BookieError struct {
+	Bookie   string
+	LedgerID int64
+	EntryID  int64
+	Status   pb.StatusCode
+	Err      error
+}
+
+func (e *BookieError) Error() string {
+	return fmt.Sprintf("%v, bookie:%s ledger:%d entry:%d", e.Err, e.Bookie, e.LedgerID, e.EntryID)
+}
+
+func (e *BookieError) Unwrap() error {
+	return e.Err
+}
+
+// DigestError is returned when a read entry frame fails verification
+type DigestError struct {
+	LedgerID int64
+	EntryID  int64
+	Err      error
+}
+
+func (e *DigestError) Error() string {
+	return fmt.Sprintf("%v, ledger:%d entry:%d", e.Err, e.LedgerID, e.EntryID)
+}
+
+func (e *DigestError) Unwrap() error {
+	return e.Err
+}
+
+// LedgerFailedError is returned by adds to a ledger failed earlier, the cause
+// may be transient but the ledger is never written again, so it's not
+// retriable
+type LedgerFailedError struct {
+	LedgerID int64
+	Err      error
+}
+
+func (e *LedgerFailedError) Error() string {
+	return fmt.Sprintf("%v: %v, ledger:%d", ErrLedgerFailed, e.Err, e.LedgerID)
+}
+
+func (e *LedgerFailedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *LedgerFailedError) Is(target error) bool {
+	return target == ErrLedgerFailed
+}
+
+// IsRetriable report whether the error is transient, the operation may
+// succeed if it's retried later or on other bookies
+func IsRetriable(err error) bool {
+	if errors.Is(err, ErrLedgerFailed) {
+		return false
+	}
+
+	switch {
+	case errors.Is(err, ErrTooManyRequests),
+		errors.Is(err, ErrBookieReadOnly),
+		errors.Is(err, ErrBookieIO),
+		errors.Is(err, ErrNotEnoughBookies),
+		errors.Is(err, ErrBookieUnavailable),
+		errors.Is(err, ErrSessionExpired),
+		errors.Is(err, context.DeadlineExceeded):
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func statusError(status pb.StatusCode) error {
+	switch status {
+	case pb.StatusCode_EOK:
+		return nil
+	case pb.StatusCode_ENOLEDGER:
+		return ErrNoSuchLedger
+	case pb.StatusCode_ENOENTRY:
+		return ErrNoSuchEntry
+	case pb.StatusCode_EBADREQ:
+		return ErrBadRequest
+	case pb.StatusCode_EIO:
+		return ErrBookieIO
+	case pb.StatusCode_EUA:
+		return ErrUnauthorizedAccess
+	case pb.StatusCode_EBADVERSION:
+		return ErrBadVersion
+	case pb.StatusCode_EFENCED:
+		return ErrLedgerFenced
+	case pb.StatusCode_EREADONLY:
+		return ErrBookieReadOnly
+	case pb.StatusCode_ETOOMANYREQUESTS:
+		return ErrTooManyRequests
+	case pb.StatusCode_EUNKNOWNLEDGERSTATE:
+		return ErrUnknownLedgerState
+	}
+	return fmt.Errorf("%w:%v", ErrUnexpectedStatus, status)
+}
@@ -0,0 +1,60 @@
+package bookkeeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/chrisxrepo/bookkeeper-client-go/pb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusError(t *testing.T) {
+	assert.NoError(t, statusError(pb.StatusCode_EOK))
+	assert.ErrorIs(t, statusError(pb.StatusCode_ENOLEDGER), ErrNoSuchLedger)
+	assert.ErrorIs(t, statusError(pb.StatusCode_ENOENTRY), ErrNoSuchEntry)
+	assert.ErrorIs(t, statusError(pb.StatusCode_EBADREQ), ErrBadRequest)
+	assert.ErrorIs(t, statusError(pb.StatusCode_EIO), ErrBookieIO)
+	assert.ErrorIs(t, statusError(pb.StatusCode_EUA), ErrUnauthorizedAccess)
+	assert.ErrorIs(t, statusError(pb.StatusCode_EBADVERSION), ErrBadVersion)
+	assert.ErrorIs(t, statusError(pb.StatusCode_EFENCED), ErrLedgerFenced)
+	assert.ErrorIs(t, statusError(pb.StatusCode_EREADONLY), ErrBookieReadOnly)
+	assert.ErrorIs(t, statusError(pb.StatusCode_ETOOMANYREQUESTS), ErrTooManyRequests)
+	assert.ErrorIs(t, statusError(pb.StatusCode_EUNKNOWNLEDGERSTATE), ErrUnknownLedgerState)
+	assert.ErrorIs(t, statusError(pb.StatusCode(999)), ErrUnexpectedStatus)
+}
+
+func TestBookieError(t *testing.T) {
+	var err error = &BookieError{
+		Bookie:   "127.0.0.1:8000",
+		LedgerID: 1,
+		EntryID:  2,
+		Status:   pb.StatusCode_EFENCED,
+		Err:      ErrLedgerFenced,
+	}
+	err = fmt.Errorf("add entry: %w", err)
+
+	assert.ErrorIs(t, err, ErrLedgerFenced)
+	assert.False(t, IsRetriable(err))
+
+	var bookieErr *BookieError
+	assert.True(t, errors.As(err, &bookieErr))
+	assert.Equal(t, "127.0.0.1:8000", bookieErr.Bookie)
+	assert.Equal(t, int64(2), bookieErr.EntryID)
+}
+
+func TestIsRetriable(t *testing.T) {
+	assert.True(t, IsRetriable(&BookieError{Err: ErrTooManyRequests}))
+	assert.True(t, IsRetriable(&BookieError{Err: ErrBookieReadOnly}))
+	assert.True(t, IsRetriable(&BookieError{Err: io.EOF}))
+	assert.True(t, IsRetriable(ErrNotEnoughBookies))
+	assert.True(t, IsRetriable(&BookieError{Err: context.DeadlineExceeded}))
+	assert.False(t, IsRetriable(context.Canceled))
+	assert.False(t, IsRetriable(&BookieError{Err: ErrNoSuchLedger}))
+	assert.False(t, IsRetriable(ErrLedgerClosed))
+	assert.False(t, IsRetriable(&DigestError{Err: ErrDigestMismatch}))
+	assert.False(t, IsRetriable(&LedgerFailedError{Err: ErrSessionExpired}))
+	assert.False(t, IsRetriable(&LedgerFailedError{Err: &BookieError{Err: ErrNotEnoughBookies}}))
+}
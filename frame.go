@@ -0,0 +1,80 @@
+package bookkeeper
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// buffers larger than this are not put back to the pool
+const maxPooledFrameSize = 64 * 1024
+
+var framePool = sync.Pool{
+	New: func() any {
+		buffer := make([]byte, 0, 4096)
+		return &buffer
+	},
+}
+
+// frameReader decode frames prefixed by a 4 bytes big endian length, the
+// buffer is reused, so a frame is only valid until the next read
+type frameReader struct {
+	in           *bufio.Reader
+	buffer       []byte
+	maxFrameSize int
+}
+
+func newFrameReader(in *bufio.Reader, maxFrameSize int) *frameReader {
+	return &frameReader{in: in, maxFrameSize: maxFrameSize}
+}
+
+func (r *frameReader) readFrame() ([]byte, error) {
+	var lengthBuf [4]byte
+	if _, err := io.ReadFull(r.in, lengthBuf[:]); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(lengthBuf[:])
+	if uint64(length) > uint64(r.maxFrameSize) {
+		return nil, fmt.Errorf("%w: %d > %d", ErrFrameTooLarge, length, r.maxFrameSize)
+	}
+
+	if cap(r.buffer) < int(length) {
+		r.buffer = make([]byte, length)
+	}
+	frame := r.buffer[:length]
+	if _, err := io.ReadFull(r.in, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// marshalFrame encode the message with length prefix into a pooled buffer,
+// which should be released by releaseFrame once written
+func marshalFrame(m proto.Message, maxFrameSize int) (*[]byte, error) {
+	size := proto.Size(m)
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("%w: %d > %d", ErrFrameTooLarge, size, maxFrameSize)
+	}
+
+	buffer := framePool.Get().(*[]byte)
+	out, err := proto.MarshalOptions{}.MarshalAppend(append((*buffer)[:0], 0, 0, 0, 0), m)
+	if err != nil {
+		releaseFrame(buffer)
+		return nil, err
+	}
+	binary.BigEndian.PutUint32(out[:4], uint32(len(out)-4))
+
+	*buffer = out
+	return buffer, nil
+}
+
+func releaseFrame(buffer *[]byte) {
+	if cap(*buffer) <= maxPooledFrameSize {
+		framePool.Put(buffer)
+	}
+}
@@ -0,0 +1,76 @@
+package bookkeeper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/chrisxrepo/bookkeeper-client-go/pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFrameReader(t *testing.T) {
+	var (
+		stream bytes.Buffer
+		large  = bytes.Repeat([]byte("x"), 300*1024)
+	)
+	for _, payload := range [][]byte{[]byte("hello"), large, []byte("bookkeeper")} {
+		var lengthBuf [4]byte
+		binary.BigEndian.PutUint32(lengthBuf[:], uint32(len(payload)))
+		stream.Write(lengthBuf[:])
+		stream.Write(payload)
+	}
+
+	reader := newFrameReader(bufio.NewReaderSize(&stream, 4096), 1024*1024)
+	frame, err := reader.readFrame()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), frame)
+
+	frame, err = reader.readFrame()
+	assert.NoError(t, err)
+	assert.Equal(t, large, frame)
+
+	// the buffer of the large frame is reused
+	frame, err = reader.readFrame()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bookkeeper"), frame)
+	assert.Equal(t, cap(reader.buffer), len(large))
+
+	_, err = reader.readFrame()
+	assert.Error(t, err)
+}
+
+func TestFrameReader_TooLarge(t *testing.T) {
+	var lengthBuf [4]byte
+	binary.BigEndian.PutUint32(lengthBuf[:], 2048)
+
+	reader := newFrameReader(bufio.NewReader(bytes.NewReader(lengthBuf[:])), 1024)
+	_, err := reader.readFrame()
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+}
+
+func TestMarshalFrame(t *testing.T) {
+	req := &pb.Request{
+		Header:     newPacketHeader(pb.OperationType_ADD_ENTRY),
+		AddRequest: &pb.AddRequest{LedgerId: proto.Int64(1), EntryId: proto.Int64(2), MasterKey: []byte("key"), Body: []byte("data")},
+	}
+
+	frame, err := marshalFrame(req, 1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	reader := newFrameReader(bufio.NewReader(bytes.NewReader(*frame)), 1024)
+	body, err := reader.readFrame()
+	assert.NoError(t, err)
+	releaseFrame(frame)
+
+	decoded := &pb.Request{}
+	assert.NoError(t, proto.Unmarshal(body, decoded))
+	assert.True(t, proto.Equal(req, decoded))
+
+	_, err = marshalFrame(req, 8)
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+}
@@ -1,28 +1,103 @@
 package bookkeeper
 
 import (
+	"context"
 	"crypto/sha1"
+	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/chrisxrepo/bookkeeper-client-go/pb"
 )
 
 type Ledger interface {
 	// GetLedgerID return ledger id
 	GetLedgerID() int64
 
-	// AddEntry add entry to ledger
-	AddEntry([]byte) error
+	// AddEntry add entry to ledger, it returns once ctx is done but the entry
+	// can't be withdrawn, it may still be confirmed later
+	AddEntry(context.Context, []byte) error
+
+	// AsyncAddEntry add entry to ledger asynchronously, callbacks are invoked
+	// in entry id order and must not block, ctx is only checked before the
+	// entry is pushed
+	AsyncAddEntry(context.Context, []byte, AddCallback)
+
+	// ReadEntries read entries from first to last, both inclusive
+	ReadEntries(ctx context.Context, first, last int64) ([]*Entry, error)
+
+	// GetLastAddConfirmed return the last add confirmed known by the handle
+	GetLastAddConfirmed() int64
+
+	// GetLastAddSynced return the last entry persisted on bookies, it falls
+	// behind the last add confirmed on a deferred sync ledger until Force
+	GetLastAddSynced() int64
+
+	// Force persist the confirmed entries of a deferred sync ledger on all
+	// bookies of the ensemble and advance the last add synced, entries of
+	// other ledgers are persisted once confirmed
+	Force(context.Context) error
+
+	// TailEntries wait at most timeout until the last add confirmed goes beyond
+	// lastSeen, then return the entries after lastSeen up to the last add
+	// confirmed, it returns no entry if timeout and ErrLedgerClosed if all the
+	// entries of a closed ledger have been seen
+	TailEntries(ctx context.Context, lastSeen int64, timeout time.Duration) ([]*Entry, error)
+
+	// ReadLastAddConfirmed ask bookies of the last ensemble for the last add
+	// confirmed, the ledger is not fenced
+	ReadLastAddConfirmed(context.Context) (int64, error)
+
+	// Close wait pending entries and seal the ledger in metadata store, the
+	// handle rejects new entries even if ctx is done before the ledger sealed,
+	// Close can be called again to seal it
+	Close(context.Context) error
+}
+
+// Entry is an entry read from ledger
+type Entry struct {
+	LedgerID int64
+	EntryID  int64
+	Data     []byte
 }
 
+// AddCallback is invoked when an entry is confirmed or failed
+type AddCallback func(entryID int64, err error)
+
 type normalLedger struct {
 	bookkeeper       *BookKeeper
+	ledgerID         int64
 	metadata         *Metadata
 	checksum         Checksum
 	ledgerKey        []byte
 	lastAddPushed    atomic.Int64
 	lastAddConfirmed atomic.Int64
+	lastAddSynced    atomic.Int64
 	length           atomic.Int64
+	writeFlags       WriteFlag
 	entryLock        sync.Mutex
+	pendingAdds      []*pendingAdd
+	draining         bool
+	err              error
+	closed           bool
+	readOnly         bool
+	lengthConfirmed  int64
+	pendingWg        sync.WaitGroup
+	closeLock        sync.Mutex
+	changingEnsemble bool
+	ensembleLock     sync.Mutex
+}
+
+type pendingAdd struct {
+	entryID   int64
+	length    int64
+	toSend    []byte
+	cb        AddCallback
+	ackSet    map[int]bool
+	completed bool
+	err       error
 }
 
 func newNormalLedger(bookkeeper *BookKeeper, metadata *Metadata) (Ledger, error) {
@@ -41,41 +116,639 @@ func newNormalLedger(bookkeeper *BookKeeper, metadata *Metadata) (Ledger, error)
 
 	l := &normalLedger{
 		bookkeeper: bookkeeper,
+		ledgerID:   metadata.ledgerID,
 		metadata:   metadata,
 		checksum:   checksum,
 		ledgerKey:  h.Sum(nil),
 	}
 	l.lastAddPushed.Store(-1)
 	l.lastAddConfirmed.Store(-1)
+	l.lastAddSynced.Store(-1)
+	if metadata.state == pb.LedgerMetadataFormat_CLOSED {
+		l.setClosed(metadata)
+	}
 
 	return l, nil
 }
 
+// refreshMetadata reload metadata for a read only handle of an open ledger, as
+// the writer may change the ensemble or close the ledger
+func (l *normalLedger) refreshMetadata(ctx context.Context) error {
+	l.entryLock.Lock()
+	var (
+		metadata = l.metadata
+		refresh  = l.readOnly && metadata.state != pb.LedgerMetadataFormat_CLOSED
+	)
+	l.entryLock.Unlock()
+
+	if !refresh {
+		return nil
+	}
+
+	metadata, err := l.bookkeeper.readLedgerMetadata(ctx, metadata.ledgerID)
+	if err != nil {
+		return err
+	}
+
+	if metadata.state == pb.LedgerMetadataFormat_CLOSED {
+		l.setClosed(metadata)
+		return nil
+	}
+
+	l.entryLock.Lock()
+	l.metadata = metadata
+	l.entryLock.Unlock()
+	return nil
+}
+
+// setClosed reset the handle to the closed metadata, the handle is read only
+func (l *normalLedger) setClosed(metadata *Metadata) {
+	l.entryLock.Lock()
+	defer l.entryLock.Unlock()
+
+	l.metadata = metadata
+	l.closed = true
+	l.lastAddPushed.Store(metadata.lastEntryID)
+	l.lastAddConfirmed.Store(metadata.lastEntryID)
+	l.length.Store(metadata.length)
+	l.lengthConfirmed = metadata.length
+}
+
 func (l *normalLedger) GetLedgerID() int64 {
-	return l.metadata.ledgerID
+	return l.ledgerID
 }
 
-func (l *normalLedger) AddEntry(data []byte) error {
+func (l *normalLedger) AddEntry(ctx context.Context, data []byte) error {
+	done := make(chan error, 1)
+	l.AsyncAddEntry(ctx, data, func(_ int64, err error) {
+		done <- err
+	})
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *normalLedger) AsyncAddEntry(ctx context.Context, data []byte, cb AddCallback) {
+	if err := ctx.Err(); err != nil {
+		cb(-1, err)
+		return
+	}
+	if l.bookkeeper.isClosed() {
+		cb(-1, ErrClientClosed)
+		return
+	}
+
 	l.entryLock.Lock()
+	if l.readOnly {
+		l.entryLock.Unlock()
+		cb(-1, ErrReadOnlyLedger)
+		return
+	}
+	if l.closed {
+		l.entryLock.Unlock()
+		cb(-1, ErrLedgerClosed)
+		return
+	}
+	if l.err != nil {
+		l.entryLock.Unlock()
+		cb(-1, l.err)
+		return
+	}
+
 	var entryID = l.lastAddPushed.Add(1)
 	var length = l.length.Add(int64(len(data)))
-	l.entryLock.Unlock()
-
 	toSend, err := l.checksum.PackageForSending(entryID, l.lastAddConfirmed.Load(), length, data)
+	if err == nil {
+		// an entry too large for any bookie must not change the ensemble
+		maxFrameSize := l.bookkeeper.cfg.maxFrameSize()
+		if size := addRequestSize(l.ledgerID, entryID, l.ledgerKey, toSend, l.writeFlags); size > maxFrameSize {
+			err = fmt.Errorf("%w: %d > %d", ErrFrameTooLarge, size, maxFrameSize)
+		}
+	}
 	if err != nil {
+		l.lastAddPushed.Add(-1)
+		l.length.Add(-int64(len(data)))
+		l.entryLock.Unlock()
+		cb(-1, err)
+		return
+	}
+
+	op := &pendingAdd{entryID: entryID, length: length, toSend: toSend, cb: cb, ackSet: make(map[int]bool)}
+	l.pendingAdds = append(l.pendingAdds, op)
+	l.pendingWg.Add(1)
+
+	var (
+		ensemble = l.metadata.getEnsemble(entryID)
+		writeSet = newWriteSet(entryID, int(l.metadata.ensembleSize), int(l.metadata.writeQuorumSize))
+	)
+	l.entryLock.Unlock()
+
+	for _, index := range writeSet {
+		l.sendAddEntry(op, index, ensemble[index])
+	}
+}
+
+func (l *normalLedger) sendAddEntry(op *pendingAdd, index int, bookie string) {
+	// the entry is not bound to the caller's ctx, a bookie not responding in
+	// add entry timeout is replaced by ensemble change
+	go func() {
+		l.addComplete(op, index, bookie, l.addEntryToBookie(context.Background(), bookie, op.entryID, op.toSend))
+	}()
+}
+
+// addComplete count the response of a bookie, the entry completes once ack
+// quorum bookies ack. A failed bookie is replaced by ensemble change and the
+// entry is resent, only fencing, unauthorized access and closing the client
+// fail the entry.
+func (l *normalLedger) addComplete(op *pendingAdd, index int, bookie string, err error) {
+	l.entryLock.Lock()
+	// ignore the response from a bookie which has been replaced
+	if op.completed || l.metadata.getEnsemble(op.entryID)[index] != bookie {
+		l.entryLock.Unlock()
+		return
+	}
+
+	if err == nil {
+		op.ackSet[index] = true
+		op.completed = len(op.ackSet) >= int(l.metadata.ackQuorumSize)
+	} else if errors.Is(err, ErrLedgerFenced) || errors.Is(err, ErrUnauthorizedAccess) || errors.Is(err, ErrClientClosed) ||
+		errors.Is(err, ErrFrameTooLarge) {
+		op.completed, op.err = true, err
+	}
+	completed := op.completed
+	l.entryLock.Unlock()
+
+	if completed {
+		l.sendAddCallbacks()
+	} else if err != nil {
+		l.changeEnsemble(index, bookie)
+	}
+}
+
+// sendAddCallbacks invoke callbacks of completed entries in entry id order,
+// only one goroutine drains the pending queue at a time. Once an entry fails
+// all the following entries fail, as the ledger can't have holes.
+func (l *normalLedger) sendAddCallbacks() {
+	l.entryLock.Lock()
+	if l.draining {
+		l.entryLock.Unlock()
+		return
+	}
+	l.draining = true
+
+	// the last add confirmed can't advance while the ensemble is changing, as
+	// the new segment starts from the last add confirmed
+	for !l.changingEnsemble && len(l.pendingAdds) > 0 && (l.pendingAdds[0].completed || l.err != nil) {
+		op := l.pendingAdds[0]
+		l.pendingAdds[0] = nil
+		l.pendingAdds = l.pendingAdds[1:]
+		op.completed = true
+
+		if l.err == nil && op.err != nil {
+			l.err = op.err
+		}
+		if l.err == nil {
+			l.lastAddConfirmed.Store(op.entryID)
+			l.lengthConfirmed = op.length
+		} else {
+			op.err = l.err
+		}
+		l.entryLock.Unlock()
+
+		op.cb(op.entryID, op.err)
+		l.pendingWg.Done()
+		l.entryLock.Lock()
+	}
+
+	l.draining = false
+	l.entryLock.Unlock()
+}
+
+func (l *normalLedger) Close(ctx context.Context) error {
+	l.closeLock.Lock()
+	defer l.closeLock.Unlock()
+
+	l.entryLock.Lock()
+	if l.readOnly || l.metadata.state == pb.LedgerMetadataFormat_CLOSED {
+		l.entryLock.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.entryLock.Unlock()
+
+	if err := l.waitPendingAdds(ctx); err != nil {
+		return err
+	}
+	// readers may read up to the last entry once the ledger is sealed
+	if err := l.Force(ctx); err != nil {
 		return err
 	}
 
-	bookies := l.metadata.ensembles[0]
-	for _, bookie := range bookies {
-		client, err := l.bookkeeper.clientPool.GetClient(bookie, l.metadata.ledgerID)
-		if err != nil {
+	l.ensembleLock.Lock()
+	defer l.ensembleLock.Unlock()
+
+	l.entryLock.Lock()
+	metadata := l.metadata.clone()
+	metadata.state = pb.LedgerMetadataFormat_CLOSED
+	metadata.lastEntryID = l.lastAddConfirmed.Load()
+	metadata.length = l.lengthConfirmed
+	l.entryLock.Unlock()
+
+	err := l.bookkeeper.updateLedgerMetadata(ctx, metadata)
+	if errors.Is(err, ErrMetadataVersionConflict) {
+		// the ledger may be closed by ourselves with a lost response, otherwise
+		// it's fenced or recovered by another client
+		current, cerr := l.bookkeeper.readLedgerMetadata(ctx, metadata.ledgerID)
+		if cerr != nil {
+			return cerr
+		}
+		if current.state != pb.LedgerMetadataFormat_CLOSED ||
+			current.lastEntryID != metadata.lastEntryID || current.length != metadata.length {
 			return err
 		}
+		metadata, err = current, nil
+	}
+	if err != nil {
+		return err
+	}
 
-		if err := client.AddEntry(l.GetLedgerID(), entryID, l.ledgerKey, toSend); err != nil {
-			return err
+	l.setClosed(metadata)
+	l.bookkeeper.removeLedger(l)
+	return nil
+}
+
+// waitPendingAdds wait all pending entries complete or ctx done
+func (l *normalLedger) waitPendingAdds(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		l.pendingWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *normalLedger) GetLastAddConfirmed() int64 {
+	return l.lastAddConfirmed.Load()
+}
+
+func (l *normalLedger) GetLastAddSynced() int64 {
+	if l.writeFlags&WriteFlagDeferredSync == 0 {
+		return l.lastAddConfirmed.Load()
+	}
+	return l.lastAddSynced.Load()
+}
+
+func (l *normalLedger) Force(ctx context.Context) error {
+	if l.readOnly {
+		return ErrReadOnlyLedger
+	}
+	if l.writeFlags&WriteFlagDeferredSync == 0 {
+		return nil
+	}
+
+	l.entryLock.Lock()
+	var (
+		metadata = l.metadata
+		err      = l.err
+	)
+	l.entryLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// entries confirmed before forcing are on the bookies
+	lastAddConfirmed := l.lastAddConfirmed.Load()
+	if lastAddConfirmed <= l.lastAddSynced.Load() {
+		return nil
+	}
+
+	var (
+		ensemble = metadata.lastEnsemble()
+		results  = make(chan error, len(ensemble))
+	)
+	for _, bookie := range ensemble {
+		go func(bookie string) {
+			client, err := l.bookkeeper.clientPool.GetClient(ctx, bookie, l.ledgerID)
+			if err == nil {
+				err = client.ForceLedger(ctx, l.ledgerID)
+			}
+			results <- err
+		}(bookie)
+	}
+	for range ensemble {
+		if rerr := <-results; rerr != nil {
+			err = rerr
 		}
 	}
+	if err != nil {
+		return err
+	}
+
+	advanceEntryID(&l.lastAddSynced, lastAddConfirmed)
 	return nil
 }
+
+func (l *normalLedger) ReadLastAddConfirmed(ctx context.Context) (int64, error) {
+	if err := l.refreshMetadata(ctx); err != nil {
+		return 0, err
+	}
+
+	l.entryLock.Lock()
+	metadata := l.metadata
+	l.entryLock.Unlock()
+
+	if metadata.state == pb.LedgerMetadataFormat_CLOSED {
+		return metadata.lastEntryID, nil
+	}
+
+	type lacResult struct {
+		lastAddConfirmed int64
+		err              error
+	}
+
+	var (
+		ensemble = metadata.lastEnsemble()
+		results  = make(chan lacResult, len(ensemble))
+	)
+	for _, bookie := range ensemble {
+		go func(bookie string) {
+			lastAddConfirmed, err := l.readBookieLac(ctx, bookie)
+			results <- lacResult{lastAddConfirmed: lastAddConfirmed, err: err}
+		}(bookie)
+	}
+
+	var (
+		lastAddConfirmed = int64(-1)
+		responded        bool
+		lastErr          error
+	)
+	for range ensemble {
+		result := <-results
+		if result.err != nil {
+			lastErr = result.err
+			continue
+		}
+
+		responded = true
+		if result.lastAddConfirmed > lastAddConfirmed {
+			lastAddConfirmed = result.lastAddConfirmed
+		}
+	}
+	if !responded {
+		return 0, lastErr
+	}
+
+	l.updateLastAddConfirmed(lastAddConfirmed)
+	return l.lastAddConfirmed.Load(), nil
+}
+
+func (l *normalLedger) TailEntries(ctx context.Context, lastSeen int64, timeout time.Duration) ([]*Entry, error) {
+	if err := l.refreshMetadata(ctx); err != nil {
+		return nil, err
+	}
+
+	l.entryLock.Lock()
+	metadata := l.metadata
+	l.entryLock.Unlock()
+
+	if metadata.state == pb.LedgerMetadataFormat_CLOSED && lastSeen >= metadata.lastEntryID {
+		return nil, ErrLedgerClosed
+	}
+
+	if lastAddConfirmed := l.lastAddConfirmed.Load(); lastAddConfirmed > lastSeen {
+		return l.ReadEntries(ctx, lastSeen+1, lastAddConfirmed)
+	}
+
+	entry, err := l.longPollReadEntry(ctx, lastSeen, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		lastAddConfirmed = l.lastAddConfirmed.Load()
+		entries          []*Entry
+	)
+	if lastAddConfirmed <= lastSeen {
+		return nil, nil
+	}
+
+	first := lastSeen + 1
+	if entry != nil {
+		entries = append(entries, entry)
+		first++
+	}
+	if first <= lastAddConfirmed {
+		more, err := l.ReadEntries(ctx, first, lastAddConfirmed)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, more...)
+	}
+	return entries, nil
+}
+
+// longPollReadEntry send long poll read to the write set of the entry
+// previousLAC+1 one by one until a bookie responds, the entry is returned if
+// it's confirmed and piggybacked in the response
+func (l *normalLedger) longPollReadEntry(ctx context.Context, previousLAC int64, timeout time.Duration) (*Entry, error) {
+	l.entryLock.Lock()
+	metadata := l.metadata
+	l.entryLock.Unlock()
+
+	var (
+		entryID  = previousLAC + 1
+		ensemble = metadata.getEnsemble(entryID)
+		writeSet = newWriteSet(entryID, int(metadata.ensembleSize), int(metadata.writeQuorumSize))
+		sequence = l.bookkeeper.placement.ReorderReadSequence(ensemble, writeSet)
+		lastErr  error
+	)
+	for _, index := range sequence {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		client, err := l.bookkeeper.clientPool.GetClient(ctx, ensemble[index], metadata.ledgerID)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		lastAddConfirmed, frame, err := client.LongPollReadEntry(ctx, metadata.ledgerID, previousLAC, timeout, true)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		l.updateLastAddConfirmed(lastAddConfirmed)
+
+		if len(frame) == 0 || entryID > l.lastAddConfirmed.Load() {
+			return nil, nil
+		}
+
+		data, lastAddConfirmed, _, err := l.checksum.VerifyDigestAndReturnData(entryID, frame)
+		if err != nil {
+			// the next replica answers at once as the lac is beyond previousLAC
+			l.bookkeeper.cfg.logger().Warn("piggybacked entry corrupted", "ledgerId", metadata.ledgerID,
+				"entryId", entryID, "bookie", ensemble[index], "error", err)
+			lastErr = err
+			continue
+		}
+		l.updateLastAddConfirmed(lastAddConfirmed)
+		return &Entry{LedgerID: metadata.ledgerID, EntryID: entryID, Data: data}, nil
+	}
+	if l.lastAddConfirmed.Load() > previousLAC {
+		// the lac is still valid, the entry is read again with the others
+		return nil, nil
+	}
+	return nil, lastErr
+}
+
+// readBookieLac return the max of explicit lac and the lac piggybacked in the
+// last entry on the bookie
+func (l *normalLedger) readBookieLac(ctx context.Context, bookie string) (int64, error) {
+	client, err := l.bookkeeper.clientPool.GetClient(ctx, bookie, l.ledgerID)
+	if err != nil {
+		return 0, err
+	}
+
+	lacBody, lastEntryBody, err := client.ReadLAC(ctx, l.ledgerID)
+	if errors.Is(err, ErrNoSuchEntry) || errors.Is(err, ErrNoSuchLedger) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var lastAddConfirmed int64 = -1
+	if len(lacBody) > 0 {
+		if lastAddConfirmed, err = l.checksum.VerifyDigestAndReturnLac(lacBody); err != nil {
+			return 0, err
+		}
+	}
+	if len(lastEntryBody) > 0 {
+		_, lac, _, err := l.checksum.VerifyDigestAndReturnData(frameEntryID(lastEntryBody), lastEntryBody)
+		if err != nil {
+			return 0, err
+		}
+		if lac > lastAddConfirmed {
+			lastAddConfirmed = lac
+		}
+	}
+	return lastAddConfirmed, nil
+}
+
+// updateLastAddConfirmed advance the last add confirmed learned from bookies
+func (l *normalLedger) updateLastAddConfirmed(lastAddConfirmed int64) {
+	advanceEntryID(&l.lastAddConfirmed, lastAddConfirmed)
+}
+
+// advanceEntryID set entryID if it's beyond the current one
+func advanceEntryID(current *atomic.Int64, entryID int64) {
+	for {
+		value := current.Load()
+		if entryID <= value || current.CompareAndSwap(value, entryID) {
+			return
+		}
+	}
+}
+
+func (l *normalLedger) ReadEntries(ctx context.Context, first, last int64) ([]*Entry, error) {
+	if first < 0 || first > last || last > l.lastAddConfirmed.Load() {
+		return nil, ErrReadOutOfRange
+	}
+
+	var (
+		entries = make([]*Entry, last-first+1)
+		errs    = make([]error, len(entries))
+		wg      sync.WaitGroup
+		limit   = make(chan struct{}, l.bookkeeper.cfg.maxReadConcurrency())
+	)
+	for i := range entries {
+		limit <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+			entries[i], errs[i] = l.readEntry(ctx, first+int64(i))
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// readEntry read entry from bookies in the write set one by one, until one
+// of them returns the entry
+func (l *normalLedger) readEntry(ctx context.Context, entryID int64) (*Entry, error) {
+	l.entryLock.Lock()
+	metadata := l.metadata
+	l.entryLock.Unlock()
+
+	var (
+		ensemble = metadata.getEnsemble(entryID)
+		writeSet = newWriteSet(entryID, int(metadata.ensembleSize), int(metadata.writeQuorumSize))
+		sequence = l.bookkeeper.placement.ReorderReadSequence(ensemble, writeSet)
+		lastErr  error
+	)
+	for _, index := range sequence {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		client, err := l.bookkeeper.clientPool.GetClient(ctx, ensemble[index], metadata.ledgerID)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		frame, err := client.ReadEntry(ctx, metadata.ledgerID, entryID)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		data, lastAddConfirmed, _, err := l.checksum.VerifyDigestAndReturnData(entryID, frame)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		l.updateLastAddConfirmed(lastAddConfirmed)
+		return &Entry{LedgerID: metadata.ledgerID, EntryID: entryID, Data: data}, nil
+	}
+	return nil, lastErr
+}
+
+func (l *normalLedger) addEntryToBookie(ctx context.Context, bookie string, entryID int64, toSend []byte) error {
+	client, err := l.bookkeeper.clientPool.GetClient(ctx, bookie, l.ledgerID)
+	if err != nil {
+		return err
+	}
+	return client.AddEntry(ctx, l.GetLedgerID(), entryID, l.ledgerKey, toSend, l.writeFlags)
+}
+
+// newWriteSet return the index of bookies in ensemble which store the entry,
+// the entry is striped round robin on the ensemble
+func newWriteSet(entryID int64, ensembleSize, writeQuorumSize int) []int {
+	writeSet := make([]int, writeQuorumSize)
+	for i := range writeSet {
+		writeSet[i] = int((entryID + int64(i)) % int64(ensembleSize))
+	}
+	return writeSet
+}
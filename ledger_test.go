@@ -1,7 +1,13 @@
 package bookkeeper
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -16,12 +22,630 @@ func TestLedger_AddEntry(t *testing.T) {
 	})
 	assert.NoError(t, err)
 
-	ledger, err := bk.CreateLeadger(3, 2, 2, []byte(""), pb.LedgerMetadataFormat_DUMMY)
+	ledger, err := bk.CreateLeadger(context.Background(), 3, 2, 2, []byte(""), pb.LedgerMetadataFormat_DUMMY)
 	assert.NoError(t, err)
 
 	fmt.Println("-------ledgerID:", ledger.GetLedgerID())
-	err = ledger.AddEntry([]byte("hello bookkeeper"))
+	err = ledger.AddEntry(context.Background(), []byte("hello bookkeeper"))
 	assert.NoError(t, err)
 
 	time.Sleep(time.Second * 5)
 }
+
+type funcClient struct {
+	emptyClient
+	addr string
+	add  func(addr string, entryID int64, payload []byte) error
+	read func(addr string, entryID int64) ([]byte, error)
+	last func(addr string) (int64, []byte, error)
+	info func(addr string) (BookieInfo, error)
+
+	force    func(addr string) error
+	addFlags func(addr string, flags WriteFlag)
+
+	// recoveryAdd is the add of recovery, add is used if it's nil
+	recoveryAdd func(addr string, entryID int64, payload []byte) error
+}
+
+func (c *funcClient) ForceLedger(ctx context.Context, ledgerID int64) error {
+	if c.force == nil {
+		return nil
+	}
+	return c.force(c.addr)
+}
+
+func (c *funcClient) GetBookieInfo(ctx context.Context, flags int64) (BookieInfo, error) {
+	if c.info == nil {
+		return BookieInfo{}, nil
+	}
+	return c.info(c.addr)
+}
+
+func (c *funcClient) Remote() string {
+	return c.addr
+}
+
+func (c *funcClient) AddEntry(ctx context.Context, ledgerID, entryID int64, mastKey []byte, payload []byte, flags WriteFlag) error {
+	if c.addFlags != nil {
+		c.addFlags(c.addr, flags)
+	}
+	if c.add == nil {
+		return nil
+	}
+	return c.add(c.addr, entryID, payload)
+}
+
+func (c *funcClient) ReadEntry(ctx context.Context, ledgerID, entryID int64) ([]byte, error) {
+	if c.read == nil {
+		return nil, errors.New("mock read not supported")
+	}
+	return c.read(c.addr, entryID)
+}
+
+func (c *funcClient) RecoveryAddEntry(ctx context.Context, ledgerID, entryID int64, mastKey []byte, payload []byte) error {
+	if c.recoveryAdd != nil {
+		return c.recoveryAdd(c.addr, entryID, payload)
+	}
+	return c.AddEntry(ctx, ledgerID, entryID, mastKey, payload, 0)
+}
+
+func (c *funcClient) FenceReadEntry(ctx context.Context, ledgerID, entryID int64, mastKey []byte) (int64, []byte, error) {
+	if entryID == -1 && c.last != nil {
+		// the bookie echoes the requested id
+		_, payload, err := c.last(c.addr)
+		return -1, payload, err
+	}
+	payload, err := c.ReadEntry(ctx, ledgerID, entryID)
+	return entryID, payload, err
+}
+
+func (c *funcClient) ReadLAC(ctx context.Context, ledgerID int64) ([]byte, []byte, error) {
+	if c.last == nil {
+		return nil, nil, errors.New("mock read lac not supported")
+	}
+	_, lastEntryBody, err := c.last(c.addr)
+	return nil, lastEntryBody, err
+}
+
+func (c *funcClient) LongPollReadEntry(ctx context.Context, ledgerID, previousLAC int64, timeout time.Duration, piggyback bool) (int64, []byte, error) {
+	if c.last == nil {
+		return 0, nil, errors.New("mock long poll not supported")
+	}
+
+	var lastAddConfirmed int64 = -1
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if _, frame, err := c.last(c.addr); err == nil {
+			lastAddConfirmed = int64(binary.BigEndian.Uint64(frame[16:24]))
+		}
+		if lastAddConfirmed > previousLAC {
+			break
+		}
+	}
+
+	if !piggyback {
+		return lastAddConfirmed, nil, nil
+	}
+	payload, _ := c.ReadEntry(ctx, ledgerID, previousLAC+1)
+	return lastAddConfirmed, payload, nil
+}
+
+func newTestLedger(t *testing.T, ensembleSize, writeQuorumSize, ackQuorumSize int32, client funcClient) *normalLedger {
+	bk := newTestBookKeeper(t, int(ensembleSize)+2, client)
+	ledger, err := bk.CreateLeadger(context.Background(), int(ensembleSize), int(writeQuorumSize), int(ackQuorumSize), nil, pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+	return ledger.(*normalLedger)
+}
+
+func openTestLedger(t *testing.T, writer *normalLedger) *normalLedger {
+	ledger, err := writer.bookkeeper.OpenLedgerNoRecovery(context.Background(), writer.GetLedgerID(), nil, pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+	return ledger.(*normalLedger)
+}
+
+// memoryBookies store entries in memory per bookie address
+type memoryBookies struct {
+	lock    sync.Mutex
+	entries map[string]map[int64][]byte
+}
+
+func newMemoryBookies() *memoryBookies {
+	return &memoryBookies{entries: make(map[string]map[int64][]byte)}
+}
+
+func (m *memoryBookies) add(addr string, entryID int64, payload []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.entries[addr] == nil {
+		m.entries[addr] = make(map[int64][]byte)
+	}
+	m.entries[addr][entryID] = payload
+	return nil
+}
+
+func (m *memoryBookies) last(addr string) (int64, []byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var lastEntryID int64 = -1
+	for entryID := range m.entries[addr] {
+		if entryID > lastEntryID {
+			lastEntryID = entryID
+		}
+	}
+	if lastEntryID < 0 {
+		return 0, nil, ErrNoSuchEntry
+	}
+	return lastEntryID, m.entries[addr][lastEntryID], nil
+}
+
+func (m *memoryBookies) read(addr string, entryID int64) ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	payload, ok := m.entries[addr][entryID]
+	if !ok {
+		return nil, statusError(pb.StatusCode_ENOENTRY)
+	}
+	return payload, nil
+}
+
+func TestLedger_WriteSet(t *testing.T) {
+	assert.Equal(t, []int{0, 1}, newWriteSet(0, 3, 2))
+	assert.Equal(t, []int{2, 0}, newWriteSet(2, 3, 2))
+	assert.Equal(t, []int{1, 2, 3}, newWriteSet(5, 4, 3))
+}
+
+func TestLedger_AddEntryQuorum(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		written = make(map[int64][]string)
+	)
+	ledger := newTestLedger(t, 3, 2, 2, funcClient{add: func(addr string, entryID int64, _ []byte) error {
+		lock.Lock()
+		defer lock.Unlock()
+		written[entryID] = append(written[entryID], addr)
+		return nil
+	}})
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, ledger.AddEntry(context.Background(), []byte("hello")))
+	}
+	assert.ElementsMatch(t, []string{"127.0.0.1:8000", "127.0.0.1:8001"}, written[0])
+	assert.ElementsMatch(t, []string{"127.0.0.1:8001", "127.0.0.1:8002"}, written[1])
+	assert.ElementsMatch(t, []string{"127.0.0.1:8002", "127.0.0.1:8000"}, written[2])
+}
+
+func TestLedger_AddEntryAckQuorum(t *testing.T) {
+	// bookie 8000 always fails, ack quorum 2 of write quorum 3 still succeed
+	ledger := newTestLedger(t, 3, 3, 2, funcClient{add: func(addr string, entryID int64, _ []byte) error {
+		if addr == "127.0.0.1:8000" {
+			return errors.New("mock error")
+		}
+		return nil
+	}})
+	assert.NoError(t, ledger.AddEntry(context.Background(), []byte("hello")))
+}
+
+func TestLedger_EnsembleChange(t *testing.T) {
+	bookies := newMemoryBookies()
+	failed := atomic.Bool{}
+	ledger := newTestLedger(t, 3, 2, 2, funcClient{add: func(addr string, entryID int64, payload []byte) error {
+		if addr == "127.0.0.1:8001" && failed.Load() {
+			return errors.New("mock error")
+		}
+		return bookies.add(addr, entryID, payload)
+	}, read: bookies.read})
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, ledger.AddEntry(context.Background(), []byte(fmt.Sprintf("entry-%d", i))))
+	}
+
+	failed.Store(true)
+	for i := 5; i < 10; i++ {
+		assert.NoError(t, ledger.AddEntry(context.Background(), []byte(fmt.Sprintf("entry-%d", i))))
+	}
+
+	// bookie 8001 is replaced from entry 5
+	metadata, err := ledger.bookkeeper.readLedgerMetadata(context.Background(), ledger.GetLedgerID())
+	assert.NoError(t, err)
+	assert.Len(t, metadata.ensembles, 2)
+	assert.Equal(t, []string{"127.0.0.1:8000", "127.0.0.1:8001", "127.0.0.1:8002"}, metadata.ensembles[0])
+	assert.NotContains(t, metadata.ensembles[5], "127.0.0.1:8001")
+	assert.Equal(t, metadata.version, ledger.metadata.version)
+
+	entries, err := ledger.ReadEntries(context.Background(), 0, 9)
+	assert.NoError(t, err)
+	for i, entry := range entries {
+		assert.Equal(t, fmt.Sprintf("entry-%d", i), string(entry.Data))
+	}
+
+	// no bookie left to replace the failed one
+	bk := newTestBookKeeper(t, 3, funcClient{add: func(addr string, entryID int64, _ []byte) error {
+		if addr == "127.0.0.1:8001" {
+			return errors.New("mock error")
+		}
+		return nil
+	}})
+	noSpare, err := bk.CreateLeadger(context.Background(), 3, 2, 2, nil, pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+	err = noSpare.AddEntry(context.Background(), []byte("hello"))
+	assert.ErrorIs(t, err, ErrNotEnoughBookies)
+
+	// the ledger stays failed, retrying it never succeeds
+	err = noSpare.AddEntry(context.Background(), []byte("hello"))
+	assert.ErrorIs(t, err, ErrLedgerFailed)
+	assert.ErrorIs(t, err, ErrNotEnoughBookies)
+	assert.False(t, IsRetriable(err))
+}
+
+func TestLedger_DeferredSync(t *testing.T) {
+	var (
+		lock   sync.Mutex
+		flags  = make(map[WriteFlag]int)
+		forced []string
+		failed atomic.Bool
+	)
+	bk := newTestBookKeeper(t, 4, funcClient{
+		addFlags: func(_ string, flag WriteFlag) {
+			lock.Lock()
+			defer lock.Unlock()
+			flags[flag]++
+		},
+		force: func(addr string) error {
+			lock.Lock()
+			defer lock.Unlock()
+			if failed.Load() && addr == "127.0.0.1:8002" {
+				return errors.New("mock force error")
+			}
+			forced = append(forced, addr)
+			return nil
+		},
+	})
+
+	ledger, err := bk.CreateLedgerWithFlags(context.Background(), 3, 2, 2, nil, pb.LedgerMetadataFormat_CRC32, WriteFlagDeferredSync)
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, ledger.AddEntry(context.Background(), []byte("hello")))
+	}
+	assert.Equal(t, map[WriteFlag]int{WriteFlagDeferredSync: 6}, flags)
+	assert.Equal(t, int64(2), ledger.GetLastAddConfirmed())
+	assert.Equal(t, int64(-1), ledger.GetLastAddSynced())
+
+	// all bookies of the ensemble are forced
+	assert.NoError(t, ledger.Force(context.Background()))
+	assert.ElementsMatch(t, testBookies(3), forced)
+	assert.Equal(t, int64(2), ledger.GetLastAddSynced())
+	assert.NoError(t, ledger.Force(context.Background()))
+	assert.Len(t, forced, 3)
+
+	// the last add synced stays if any bookie fails
+	assert.NoError(t, ledger.AddEntry(context.Background(), []byte("hello")))
+	failed.Store(true)
+	assert.Error(t, ledger.Force(context.Background()))
+	assert.Equal(t, int64(2), ledger.GetLastAddSynced())
+	assert.Error(t, ledger.Close(context.Background()))
+
+	// entries are forced before the ledger is sealed
+	failed.Store(false)
+	assert.NoError(t, ledger.Close(context.Background()))
+	assert.Equal(t, int64(3), ledger.GetLastAddSynced())
+
+	// entries of other ledgers are synced once confirmed
+	forced = nil
+	ledger, err = bk.CreateLeadger(context.Background(), 3, 2, 2, nil, pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+	assert.NoError(t, ledger.AddEntry(context.Background(), []byte("hello")))
+	assert.Equal(t, int64(0), ledger.GetLastAddSynced())
+	assert.NoError(t, ledger.Force(context.Background()))
+	assert.Empty(t, forced)
+	assert.Equal(t, 8, flags[WriteFlagDeferredSync])
+	assert.Equal(t, 2, flags[0])
+}
+
+func TestLedger_DeferredSyncEnsembleChange(t *testing.T) {
+	bk := newTestBookKeeper(t, 4, funcClient{add: func(addr string, entryID int64, _ []byte) error {
+		if addr == "127.0.0.1:8002" {
+			return errors.New("mock error")
+		}
+		return nil
+	}})
+
+	// the failed bookie can't be replaced, the spare bookie is not used
+	ledger, err := bk.CreateLedgerWithFlags(context.Background(), 3, 2, 2, nil, pb.LedgerMetadataFormat_CRC32, WriteFlagDeferredSync)
+	assert.NoError(t, err)
+	assert.NoError(t, ledger.AddEntry(context.Background(), []byte("hello")))
+	assert.ErrorIs(t, ledger.AddEntry(context.Background(), []byte("hello")), ErrDeferredSyncNotAllowed)
+	assert.ErrorIs(t, ledger.Force(context.Background()), ErrDeferredSyncNotAllowed)
+
+	metadata, err := bk.readLedgerMetadata(context.Background(), ledger.GetLedgerID())
+	assert.NoError(t, err)
+	assert.Len(t, metadata.ensembles, 1)
+}
+
+func TestLedger_AddEntryTooLarge(t *testing.T) {
+	var added atomic.Int32
+	bk := newTestBookKeeperConfig(t, &Config{PlacementPolicy: newOrderedPlacementPolicy(), MaxFrameSize: 1024}, 5,
+		funcClient{add: func(addr string, entryID int64, _ []byte) error {
+			added.Add(1)
+			if entryID == 1 {
+				return &BookieError{Bookie: addr, EntryID: entryID, Err: ErrFrameTooLarge}
+			}
+			return nil
+		}})
+	ledger, err := bk.CreateLeadger(context.Background(), 3, 2, 2, nil, pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+
+	// the oversized entry is rejected before it's sent, the entry id is reused
+	assert.ErrorIs(t, ledger.AddEntry(context.Background(), make([]byte, 1024)), ErrFrameTooLarge)
+	assert.Equal(t, int32(0), added.Load())
+	assert.NoError(t, ledger.AddEntry(context.Background(), []byte("hello")))
+	assert.Equal(t, int64(0), ledger.GetLastAddConfirmed())
+
+	// a bookie refusing the frame fails the entry, no bookie is replaced
+	assert.ErrorIs(t, ledger.AddEntry(context.Background(), []byte("hello")), ErrFrameTooLarge)
+	metadata, err := bk.readLedgerMetadata(context.Background(), ledger.GetLedgerID())
+	assert.NoError(t, err)
+	assert.Len(t, metadata.ensembles, 1)
+	assert.Empty(t, bk.quarantine.list())
+}
+
+func TestLedger_AsyncAddEntryOrder(t *testing.T) {
+	ledger := newTestLedger(t, 3, 2, 2, funcClient{add: func(addr string, entryID int64, _ []byte) error {
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+		return nil
+	}})
+
+	var (
+		wg        sync.WaitGroup
+		completed []int64
+	)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		ledger.AsyncAddEntry(context.Background(), []byte("hello"), func(entryID int64, err error) {
+			defer wg.Done()
+			assert.NoError(t, err)
+			assert.Equal(t, entryID, ledger.lastAddConfirmed.Load())
+			completed = append(completed, entryID)
+		})
+	}
+	wg.Wait()
+
+	assert.Len(t, completed, 100)
+	for i, entryID := range completed {
+		assert.Equal(t, int64(i), entryID)
+	}
+}
+
+func TestLedger_AsyncAddEntryFailed(t *testing.T) {
+	ledger := newTestLedger(t, 3, 2, 2, funcClient{add: func(addr string, entryID int64, _ []byte) error {
+		if entryID == 5 {
+			return ErrLedgerFenced
+		}
+		return nil
+	}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		ledger.AsyncAddEntry(context.Background(), []byte("hello"), func(entryID int64, err error) {
+			defer wg.Done()
+			if entryID < 5 {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(4), ledger.lastAddConfirmed.Load())
+	assert.Error(t, ledger.AddEntry(context.Background(), []byte("hello")))
+}
+
+func TestLedger_AddEntryContext(t *testing.T) {
+	release := make(chan struct{})
+	ledger := newTestLedger(t, 3, 2, 2, funcClient{add: func(addr string, entryID int64, _ []byte) error {
+		<-release
+		return nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ledger.AsyncAddEntry(ctx, []byte("hello"), func(entryID int64, err error) {
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, int64(-1), entryID)
+	})
+	assert.Equal(t, int64(-1), ledger.lastAddPushed.Load())
+
+	// the entry pushed is still confirmed after the caller gives up
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, ledger.AddEntry(ctx, []byte("hello")), context.DeadlineExceeded)
+	close(release)
+	assert.Eventually(t, func() bool { return ledger.GetLastAddConfirmed() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestLedger_Close(t *testing.T) {
+	bk := newTestBookKeeper(t, 3, funcClient{})
+	ledger, err := bk.CreateLeadger(context.Background(), 3, 2, 2, nil, pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+
+	err = ledger.AddEntry(context.Background(), []byte("hello bookkeeper"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, ledger.Close(context.Background()))
+	assert.ErrorIs(t, ledger.AddEntry(context.Background(), []byte("hello bookkeeper")), ErrLedgerClosed)
+
+	mt, err := bk.readLedgerMetadata(context.Background(), ledger.GetLedgerID())
+	assert.NoError(t, err)
+	assert.Equal(t, pb.LedgerMetadataFormat_CLOSED, mt.state)
+	assert.Equal(t, int64(0), mt.lastEntryID)
+	assert.Equal(t, int64(len("hello bookkeeper")), mt.length)
+
+	// the metadata changed by another client is not overwritten
+	ledger, err = bk.CreateLeadger(context.Background(), 3, 2, 2, nil, pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+	assert.NoError(t, ledger.AddEntry(context.Background(), []byte("hello bookkeeper")))
+	mt, err = bk.readLedgerMetadata(context.Background(), ledger.GetLedgerID())
+	assert.NoError(t, err)
+	mt.state = pb.LedgerMetadataFormat_IN_RECOVERY
+	assert.NoError(t, bk.updateLedgerMetadata(context.Background(), mt))
+
+	assert.ErrorIs(t, ledger.Close(context.Background()), ErrMetadataVersionConflict)
+	mt, err = bk.readLedgerMetadata(context.Background(), ledger.GetLedgerID())
+	assert.NoError(t, err)
+	assert.Equal(t, pb.LedgerMetadataFormat_IN_RECOVERY, mt.state)
+}
+
+func TestLedger_ReadEntries(t *testing.T) {
+	bookies := newMemoryBookies()
+	ledger := newTestLedger(t, 3, 2, 2, funcClient{add: bookies.add, read: bookies.read})
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, ledger.AddEntry(context.Background(), []byte(fmt.Sprintf("entry-%d", i))))
+	}
+
+	// the first bookie of every write set lost its data, read from the next replica
+	bookies.lock.Lock()
+	delete(bookies.entries, "127.0.0.1:8000")
+	bookies.lock.Unlock()
+
+	entries, err := ledger.ReadEntries(context.Background(), 2, 9)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 8)
+	for i, entry := range entries {
+		assert.Equal(t, int64(i+2), entry.EntryID)
+		assert.Equal(t, fmt.Sprintf("entry-%d", i+2), string(entry.Data))
+	}
+
+	_, err = ledger.ReadEntries(context.Background(), 5, 10)
+	assert.ErrorIs(t, err, ErrReadOutOfRange)
+}
+
+func TestLedger_ReadEntriesConcurrency(t *testing.T) {
+	var (
+		bookies       = newMemoryBookies()
+		reading, most atomic.Int32
+	)
+	client := funcClient{add: bookies.add, read: func(addr string, entryID int64) ([]byte, error) {
+		n := reading.Add(1)
+		defer reading.Add(-1)
+		for m := most.Load(); n > m; m = most.Load() {
+			if most.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return bookies.read(addr, entryID)
+	}}
+	bk := newTestBookKeeperConfig(t, &Config{PlacementPolicy: newOrderedPlacementPolicy(), MaxReadConcurrency: 4}, 5, client)
+	ledger, err := bk.CreateLeadger(context.Background(), 3, 2, 2, nil, pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+	for i := 0; i < 33; i++ {
+		assert.NoError(t, ledger.AddEntry(context.Background(), []byte(fmt.Sprintf("entry-%d", i))))
+	}
+
+	entries, err := ledger.ReadEntries(context.Background(), 0, 31)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 32)
+	assert.LessOrEqual(t, most.Load(), int32(4))
+	assert.Greater(t, most.Load(), int32(1))
+}
+
+func TestLedger_ReadLastAddConfirmed(t *testing.T) {
+	bookies := newMemoryBookies()
+	client := funcClient{add: bookies.add, read: bookies.read, last: bookies.last}
+	writer := newTestLedger(t, 3, 2, 2, client)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, writer.AddEntry(context.Background(), []byte("hello")))
+	}
+
+	reader := openTestLedger(t, writer)
+	assert.Equal(t, int64(-1), reader.GetLastAddConfirmed())
+
+	// the last entry 9 piggybacks lac 8
+	lac, err := reader.ReadLastAddConfirmed(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), lac)
+
+	entries, err := reader.ReadEntries(context.Background(), 0, 8)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 9)
+
+	_, err = reader.ReadEntries(context.Background(), 0, 9)
+	assert.ErrorIs(t, err, ErrReadOutOfRange)
+
+	assert.ErrorIs(t, reader.AddEntry(context.Background(), []byte("hello")), ErrReadOnlyLedger)
+	assert.NoError(t, reader.Close(context.Background()))
+	assert.NoError(t, writer.AddEntry(context.Background(), []byte("hello")))
+}
+
+func TestLedger_TailEntriesCorruptedPiggyback(t *testing.T) {
+	var (
+		bookies   = newMemoryBookies()
+		corrupted atomic.Bool
+	)
+	client := funcClient{add: bookies.add, last: bookies.last, read: func(addr string, entryID int64) ([]byte, error) {
+		frame, err := bookies.read(addr, entryID)
+		if err == nil && corrupted.CompareAndSwap(false, true) {
+			frame = append([]byte{}, frame...)
+			frame[len(frame)-1] ^= 0xff
+		}
+		return frame, err
+	}}
+	writer := newTestLedger(t, 3, 3, 2, client)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, writer.AddEntry(context.Background(), []byte(fmt.Sprintf("entry-%d", i))))
+	}
+
+	// the first replica piggybacks a corrupted entry, the next one is read
+	reader := openTestLedger(t, writer)
+	entries, err := reader.TailEntries(context.Background(), -1, time.Second)
+	assert.NoError(t, err)
+	assert.True(t, corrupted.Load())
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "entry-0", string(entries[0].Data))
+	}
+}
+
+func TestLedger_TailEntries(t *testing.T) {
+	bookies := newMemoryBookies()
+	client := funcClient{add: bookies.add, read: bookies.read, last: bookies.last}
+	writer := newTestLedger(t, 3, 3, 2, client)
+	reader := openTestLedger(t, writer)
+
+	// nothing written, the long poll times out
+	entries, err := reader.TailEntries(context.Background(), -1, 10*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	go func() {
+		for i := 0; i < 5; i++ {
+			time.Sleep(5 * time.Millisecond)
+			writer.AddEntry(context.Background(), []byte(fmt.Sprintf("entry-%d", i)))
+		}
+	}()
+
+	// the last entry is confirmed by the piggybacked lac of the next entry
+	var lastSeen int64 = -1
+	for lastSeen < 3 {
+		entries, err := reader.TailEntries(context.Background(), lastSeen, time.Second)
+		assert.NoError(t, err)
+		for _, entry := range entries {
+			lastSeen++
+			assert.Equal(t, lastSeen, entry.EntryID)
+			assert.Equal(t, fmt.Sprintf("entry-%d", lastSeen), string(entry.Data))
+		}
+	}
+	assert.Equal(t, int64(3), lastSeen)
+
+	// the closed ledger ends at entry 4
+	assert.Eventually(t, func() bool { return writer.GetLastAddConfirmed() == 4 }, time.Second, time.Millisecond)
+	assert.NoError(t, writer.Close(context.Background()))
+	entries, err = reader.TailEntries(context.Background(), lastSeen, time.Second)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	_, err = reader.TailEntries(context.Background(), 4, time.Second)
+	assert.ErrorIs(t, err, ErrLedgerClosed)
+}
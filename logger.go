@@ -0,0 +1,18 @@
+package bookkeeper
+
+// Logger is the logging interface of the client, keyvals are alternating keys
+// and values of structured fields. *slog.Logger implements it.
+type Logger interface {
+	Debug(msg string, keyvals ...any)
+	Info(msg string, keyvals ...any)
+	Warn(msg string, keyvals ...any)
+	Error(msg string, keyvals ...any)
+}
+
+// nopLogger discard all logs, it's the default logger
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, keyvals ...any) {}
+func (nopLogger) Info(msg string, keyvals ...any)  {}
+func (nopLogger) Warn(msg string, keyvals ...any)  {}
+func (nopLogger) Error(msg string, keyvals ...any) {}
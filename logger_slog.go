@@ -0,0 +1,16 @@
+//go:build go1.21
+
+package bookkeeper
+
+import (
+	"log/slog"
+)
+
+// NewSlogLogger return Logger writing to the slog logger, slog.Default() is
+// used if logger is nil
+func NewSlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger
+}
@@ -0,0 +1,29 @@
+//go:build go1.21
+
+package bookkeeper
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSlogLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := NewSlogLogger(slog.New(slog.NewJSONHandler(&buffer, nil)))
+
+	logger.Debug("bookie event", "path", "/ledgers/available")
+	logger.Warn("bookie request timeout", "bookie", "127.0.0.1:3181", "txnId", 10)
+
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &record))
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "bookie request timeout", record["msg"])
+	assert.Equal(t, "127.0.0.1:3181", record["bookie"])
+	assert.Equal(t, float64(10), record["txnId"])
+
+	assert.NotNil(t, NewSlogLogger(nil))
+}
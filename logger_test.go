@@ -0,0 +1,71 @@
+package bookkeeper
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chrisxrepo/bookkeeper-client-go/pb"
+	"github.com/stretchr/testify/assert"
+)
+
+type logRecord struct {
+	level   string
+	msg     string
+	keyvals []any
+}
+
+// recordLogger keep logs in memory for tests
+type recordLogger struct {
+	lock    sync.Mutex
+	records []logRecord
+}
+
+func (l *recordLogger) log(level, msg string, keyvals []any) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.records = append(l.records, logRecord{level: level, msg: msg, keyvals: keyvals})
+}
+
+func (l *recordLogger) Debug(msg string, keyvals ...any) { l.log("debug", msg, keyvals) }
+func (l *recordLogger) Info(msg string, keyvals ...any)  { l.log("info", msg, keyvals) }
+func (l *recordLogger) Warn(msg string, keyvals ...any)  { l.log("warn", msg, keyvals) }
+func (l *recordLogger) Error(msg string, keyvals ...any) { l.log("error", msg, keyvals) }
+
+func (l *recordLogger) find(msg string) (logRecord, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for _, record := range l.records {
+		if record.msg == msg {
+			return record, true
+		}
+	}
+	return logRecord{}, false
+}
+
+func TestLogger_Default(t *testing.T) {
+	var cfg Config
+	assert.Equal(t, nopLogger{}, cfg.logger())
+}
+
+func TestLogger_ConnectionLost(t *testing.T) {
+	addr := newMockBookie(t, func(req *pb.Request) *pb.Response { return nil })
+
+	logger := &recordLogger{}
+	c, err := newClient(context.Background(), &Config{Logger: logger, ReconnectBackoff: time.Millisecond}, addr)
+	assert.NoError(t, err)
+	defer c.Close()
+
+	c.(*bookieClient).conn.Close()
+	assert.Eventually(t, func() bool {
+		_, ok := logger.find("bookie reconnected")
+		return ok
+	}, time.Second, time.Millisecond)
+
+	record, ok := logger.find("bookie connection lost")
+	assert.True(t, ok)
+	assert.Equal(t, "warn", record.level)
+	assert.Equal(t, []any{"bookie", addr}, record.keyvals[:2])
+}
@@ -2,8 +2,9 @@ package bookkeeper
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
 
 	"github.com/chrisxrepo/bookkeeper-client-go/pb"
@@ -34,6 +35,22 @@ type Metadata struct {
 	ctime           int64
 	ensembles       map[int64][]string
 	customMetadata  map[string][]byte
+
+	// znode version of the metadata, not serialized
+	version int32
+}
+
+func (m *Metadata) clone() *Metadata {
+	newMt := *m
+	newMt.ensembles = make(map[int64][]string, len(m.ensembles))
+	for entryID, ensemble := range m.ensembles {
+		newMt.ensembles[entryID] = append([]string{}, ensemble...)
+	}
+	newMt.customMetadata = make(map[string][]byte, len(m.customMetadata))
+	for key, value := range m.customMetadata {
+		newMt.customMetadata[key] = value
+	}
+	return &newMt
 }
 
 func (m *Metadata) Serialize() ([]byte, error) {
@@ -54,14 +71,19 @@ func (m *Metadata) Serialize() ([]byte, error) {
 
 	for key, value := range m.customMetadata {
 		builder.CustomMetadata = append(builder.CustomMetadata, &pb.LedgerMetadataFormatCMetadataMapEntry{
-			Key:   &key,
+			Key:   proto.String(key),
 			Value: value,
 		})
 	}
 
-	for entry, number := range m.ensembles {
+	firstEntryIDs := make([]int64, 0, len(m.ensembles))
+	for firstEntryID := range m.ensembles {
+		firstEntryIDs = append(firstEntryIDs, firstEntryID)
+	}
+	sort.Slice(firstEntryIDs, func(i, j int) bool { return firstEntryIDs[i] < firstEntryIDs[j] })
+	for _, firstEntryID := range firstEntryIDs {
 		builder.Segment = append(builder.Segment, &pb.LedgerMetadataFormat_Segment{
-			FirstEntryId: &entry, EnsembleMember: number,
+			FirstEntryId: proto.Int64(firstEntryID), EnsembleMember: m.ensembles[firstEntryID],
 		})
 	}
 
@@ -88,7 +110,7 @@ func (m *Metadata) Parse(is *bytes.Buffer) error {
 	if builder.LastEntryId != nil {
 		m.lastEntryID = *builder.LastEntryId
 	}
-	if builder.LastEntryId != nil {
+	if builder.EnsembleSize != nil {
 		m.ensembleSize = *builder.EnsembleSize
 	}
 	if builder.QuorumSize != nil {
@@ -126,10 +148,29 @@ func (m *Metadata) Parse(is *bytes.Buffer) error {
 	return nil
 }
 
+// getEnsemble return the ensemble of the segment which the entry belongs to
+func (m *Metadata) getEnsemble(entryID int64) []string {
+	var (
+		ensemble []string
+		firstID  int64 = -1
+	)
+	for id, bookies := range m.ensembles {
+		if id <= entryID && id > firstID {
+			firstID, ensemble = id, bookies
+		}
+	}
+	return ensemble
+}
+
+// lastEnsemble return the ensemble of the last segment
+func (m *Metadata) lastEnsemble() []string {
+	return m.getEnsemble(math.MaxInt64)
+}
+
 func readHeader(os *bytes.Buffer) (int, error) {
 	bs := os.Next(len(_VERSION_KEY_BYTES))
 	if !BytesEqual(bs, _VERSION_KEY_BYTES) {
-		return 0, errors.New("Invalid ledger metadata header")
+		return 0, fmt.Errorf("%w: invalid header", ErrInvalidMetadata)
 	}
 
 	var vsStr = make([]byte, 0, _MAX_VERSION_DIGITS)
@@ -144,7 +185,7 @@ func readHeader(os *bytes.Buffer) (int, error) {
 	}
 
 	if version, _ := strconv.ParseInt(string(vsStr), 10, 0); pb.ProtocolVersion(version) != pb.ProtocolVersion_VERSION_THREE {
-		return 0, fmt.Errorf("Not support version %s", string(vsStr))
+		return 0, fmt.Errorf("%w: not support version %s", ErrInvalidMetadata, string(vsStr))
 	}
 	return int(pb.ProtocolVersion_VERSION_THREE), nil
 }
@@ -2,6 +2,7 @@ package bookkeeper
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"math/rand"
 	"testing"
@@ -46,7 +47,7 @@ func TestParseMetadata(t *testing.T) {
 	})
 	assert.NoError(t, err)
 
-	bs, err := zk.GetData(getLedgerPath(20))
+	bs, err := zk.GetData(context.Background(), getLedgerPath(20))
 	assert.NoError(t, err)
 
 	mt := &Metadata{ledgerID: 10}
@@ -78,3 +79,19 @@ func TestProtoMarshal(t *testing.T) {
 	err = proto.Unmarshal(bs.Bytes(), &ledger)
 	assert.NoError(t, err)
 }
+
+func TestMetadataClone(t *testing.T) {
+	mt := &Metadata{
+		ledgerID:  100,
+		ensembles: map[int64][]string{0: {"127.0.0.1:8000", "127.0.0.1:8001"}},
+		version:   3,
+	}
+
+	newMt := mt.clone()
+	newMt.ensembles[0][1] = "127.0.0.1:8002"
+	newMt.ensembles[10] = []string{"127.0.0.1:8000", "127.0.0.1:8002"}
+
+	assert.Equal(t, int32(3), newMt.version)
+	assert.Equal(t, "127.0.0.1:8001", mt.ensembles[0][1])
+	assert.Len(t, mt.ensembles, 1)
+}
@@ -0,0 +1,154 @@
+package bookkeeper
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EnsemblePlacementPolicy choose bookies of ledger ensembles and the order of
+// bookies to read entries from. A policy is used by one BookKeeper only, it's
+// called from multiple goroutines.
+type EnsemblePlacementPolicy interface {
+	// OnClusterChanged update the writable and read only bookies, it's called
+	// on creating BookKeeper and every time the bookies change
+	OnClusterChanged(writable, readOnly []string)
+
+	// NewEnsemble choose ensembleSize writable bookies not in excluded,
+	// ErrNotEnoughBookies is returned if there are not enough of them
+	NewEnsemble(ensembleSize, writeQuorumSize, ackQuorumSize int, excluded []string) ([]string, error)
+
+	// ReplaceBookie choose a writable bookie to replace bookie of the
+	// ensemble, it must not be in the ensemble nor in excluded
+	ReplaceBookie(ensembleSize, writeQuorumSize, ackQuorumSize int, ensemble []string, bookie string, excluded []string) (string, error)
+
+	// ReorderReadSequence return the write set of an entry in the order its
+	// bookies are read, the write set must not be modified
+	ReorderReadSequence(ensemble []string, writeSet []int) []int
+}
+
+// RandomPlacementPolicy choose bookies randomly, and read the writable bookies
+// of the write set first, then read only bookies, then the bookies left
+type RandomPlacementPolicy struct {
+	lock     sync.RWMutex
+	writable []string
+	readOnly []string
+
+	shuffle func(n int, swap func(i, j int))
+}
+
+func NewRandomPlacementPolicy() *RandomPlacementPolicy {
+	return &RandomPlacementPolicy{shuffle: rand.Shuffle}
+}
+
+func (p *RandomPlacementPolicy) OnClusterChanged(writable, readOnly []string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.writable = writable
+	p.readOnly = readOnly
+}
+
+func (p *RandomPlacementPolicy) NewEnsemble(ensembleSize, writeQuorumSize, ackQuorumSize int, excluded []string) ([]string, error) {
+	candidates := p.candidates(excluded)
+	if len(candidates) < ensembleSize {
+		return nil, ErrNotEnoughBookies
+	}
+	return candidates[:ensembleSize], nil
+}
+
+func (p *RandomPlacementPolicy) ReplaceBookie(ensembleSize, writeQuorumSize, ackQuorumSize int, ensemble []string, bookie string, excluded []string) (string, error) {
+	candidates := p.candidates(append(append([]string{}, excluded...), ensemble...))
+	if len(candidates) == 0 {
+		return "", ErrNotEnoughBookies
+	}
+	return candidates[0], nil
+}
+
+func (p *RandomPlacementPolicy) ReorderReadSequence(ensemble []string, writeSet []int) []int {
+	return reorderReadSequence(writeSet, func(index int) int {
+		return p.readTier(ensemble[index])
+	})
+}
+
+// readTier return the order to read the bookie, writable bookies first, then
+// read only bookies, then bookies left the cluster as they may be down
+func (p *RandomPlacementPolicy) readTier(bookie string) int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	switch {
+	case containsString(p.writable, bookie):
+		return 0
+	case containsString(p.readOnly, bookie):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// reorderReadSequence return a copy of the write set sorted by tier, the
+// order of bookies in the same tier is kept
+func reorderReadSequence(writeSet []int, tier func(index int) int) []int {
+	sequence := append([]int{}, writeSet...)
+	sort.SliceStable(sequence, func(i, j int) bool {
+		return tier(sequence[i]) < tier(sequence[j])
+	})
+	return sequence
+}
+
+// candidates return writable bookies not excluded in random order
+func (p *RandomPlacementPolicy) candidates(excluded []string) []string {
+	p.lock.RLock()
+	candidates := make([]string, 0, len(p.writable))
+	for _, bookie := range p.writable {
+		if !containsString(excluded, bookie) {
+			candidates = append(candidates, bookie)
+		}
+	}
+	p.lock.RUnlock()
+
+	p.shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	return candidates
+}
+
+// quarantine keep bookies failed recently, placement avoids them until the
+// quarantine time passes, unless there are not enough other bookies
+type quarantine struct {
+	lock    sync.Mutex
+	period  time.Duration
+	bookies map[string]time.Time // bookie -> quarantined until
+}
+
+func newQuarantine(period time.Duration) *quarantine {
+	return &quarantine{period: period, bookies: make(map[string]time.Time)}
+}
+
+func (q *quarantine) add(bookie string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.bookies[bookie] = time.Now().Add(q.period)
+}
+
+// list return bookies still in quarantine, expired ones are released
+func (q *quarantine) list() []string {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var (
+		now     = time.Now()
+		bookies []string
+	)
+	for bookie, until := range q.bookies {
+		if now.After(until) {
+			delete(q.bookies, bookie)
+			continue
+		}
+		bookies = append(bookies, bookie)
+	}
+	return bookies
+}
@@ -0,0 +1,188 @@
+package bookkeeper
+
+import (
+	"strings"
+	"sync"
+)
+
+const defaultRack = "/default-region/default-rack"
+
+// RackResolver return the network location of the bookie as /region/rack
+type RackResolver interface {
+	Resolve(bookie string) string
+}
+
+// RackResolverFunc adapt a function to RackResolver
+type RackResolverFunc func(bookie string) string
+
+func (f RackResolverFunc) Resolve(bookie string) string {
+	return f(bookie)
+}
+
+// StaticRackResolver map bookie address to /region/rack
+type StaticRackResolver map[string]string
+
+func (r StaticRackResolver) Resolve(bookie string) string {
+	return r[bookie]
+}
+
+// RackAwarePlacementPolicy spread every write quorum across distinct racks,
+// bookies on the same rack are only placed in a write quorum if there are not
+// enough racks. Bookies are read as RandomPlacementPolicy does.
+type RackAwarePlacementPolicy struct {
+	random   *RandomPlacementPolicy
+	resolver RackResolver
+
+	lock  sync.RWMutex
+	racks map[string]string // bookie -> /region/rack
+}
+
+func NewRackAwarePlacementPolicy(resolver RackResolver) *RackAwarePlacementPolicy {
+	return &RackAwarePlacementPolicy{
+		random:   NewRandomPlacementPolicy(),
+		resolver: resolver,
+		racks:    make(map[string]string),
+	}
+}
+
+func (p *RackAwarePlacementPolicy) OnClusterChanged(writable, readOnly []string) {
+	racks := make(map[string]string, len(writable))
+	for _, bookie := range writable {
+		racks[bookie] = resolveRack(p.resolver, bookie)
+	}
+
+	p.lock.Lock()
+	p.racks = racks
+	p.lock.Unlock()
+
+	p.random.OnClusterChanged(writable, readOnly)
+}
+
+func (p *RackAwarePlacementPolicy) NewEnsemble(ensembleSize, writeQuorumSize, ackQuorumSize int, excluded []string) ([]string, error) {
+	candidates := p.random.candidates(excluded)
+	if len(candidates) < ensembleSize {
+		return nil, ErrNotEnoughBookies
+	}
+
+	ensemble := make([]string, ensembleSize)
+	for index := range ensemble {
+		i := p.pick(candidates, ensemble, index, writeQuorumSize)
+		ensemble[index] = candidates[i]
+		candidates = append(candidates[:i], candidates[i+1:]...)
+	}
+	return ensemble, nil
+}
+
+func (p *RackAwarePlacementPolicy) ReplaceBookie(ensembleSize, writeQuorumSize, ackQuorumSize int, ensemble []string, bookie string, excluded []string) (string, error) {
+	candidates := p.random.candidates(append(append([]string{}, excluded...), ensemble...))
+	if len(candidates) == 0 {
+		return "", ErrNotEnoughBookies
+	}
+
+	index := indexString(ensemble, bookie)
+	if index < 0 {
+		return candidates[0], nil
+	}
+	rest := append([]string{}, ensemble...)
+	rest[index] = ""
+	return candidates[p.pick(candidates, rest, index, writeQuorumSize)], nil
+}
+
+func (p *RackAwarePlacementPolicy) ReorderReadSequence(ensemble []string, writeSet []int) []int {
+	return p.random.ReorderReadSequence(ensemble, writeSet)
+}
+
+// pick return the candidate sharing racks with the fewest bookies placed in
+// write quorums with the index of ensemble, empty entries are not placed yet
+func (p *RackAwarePlacementPolicy) pick(candidates, ensemble []string, index, writeQuorumSize int) int {
+	return pickBookie(candidates, ensemble, index, writeQuorumSize, p.rack)
+}
+
+func (p *RackAwarePlacementPolicy) rack(bookie string) string {
+	p.lock.RLock()
+	rack, ok := p.racks[bookie]
+	p.lock.RUnlock()
+
+	if !ok {
+		// the bookie left the cluster
+		rack = resolveRack(p.resolver, bookie)
+	}
+	return rack
+}
+
+// quorumNeighbors return indexes of the ensemble sharing a write quorum with
+// the index, entries are striped round robin so they are within distance
+// writeQuorumSize-1
+func quorumNeighbors(ensembleSize, index, writeQuorumSize int) []int {
+	var neighbors []int
+	for d := 1; d < writeQuorumSize && d < ensembleSize; d++ {
+		for _, j := range []int{(index + d) % ensembleSize, (index - d + ensembleSize) % ensembleSize} {
+			if j != index && !containsInt(neighbors, j) {
+				neighbors = append(neighbors, j)
+			}
+		}
+	}
+	return neighbors
+}
+
+// pickBookie return the candidate sharing locations with the fewest bookies
+// placed in write quorums with the index of ensemble, the locations are
+// compared in order. Ties are broken by the first location with the most
+// candidates left, so locations run out evenly and the last positions still
+// have distinct locations to choose.
+func pickBookie(candidates, ensemble []string, index, writeQuorumSize int, locations ...func(bookie string) string) int {
+	var (
+		neighbors = quorumNeighbors(len(ensemble), index, writeQuorumSize)
+		left      = make(map[string]int)
+		best      []int
+		bestIndex int
+	)
+	for _, candidate := range candidates {
+		left[locations[0](candidate)]++
+	}
+
+	for i, candidate := range candidates {
+		score := make([]int, 0, len(locations)+1)
+		for _, location := range locations {
+			var (
+				loc   = location(candidate)
+				count = 0
+			)
+			for _, j := range neighbors {
+				if ensemble[j] != "" && location(ensemble[j]) == loc {
+					count++
+				}
+			}
+			score = append(score, count)
+		}
+		score = append(score, -left[locations[0](candidate)])
+
+		if best == nil || lessInts(score, best) {
+			best, bestIndex = score, i
+		}
+	}
+	return bestIndex
+}
+
+// lessInts compare int slices of the same length lexicographically
+func lessInts(a, b []int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// resolveRack return the location of bookie, the default rack is used for
+// bookies not resolved
+func resolveRack(resolver RackResolver, bookie string) string {
+	rack := resolver.Resolve(bookie)
+	if rack == "" {
+		return defaultRack
+	}
+	if !strings.HasPrefix(rack, "/") {
+		rack = "/" + rack
+	}
+	return rack
+}
@@ -0,0 +1,108 @@
+package bookkeeper
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testRacks place bookies of testBookies round robin on n racks
+func testRacks(bookieNum, n int) StaticRackResolver {
+	racks := make(StaticRackResolver)
+	for i, bookie := range testBookies(bookieNum) {
+		racks[bookie] = fmt.Sprintf("/region/rack-%d", i%n)
+	}
+	return racks
+}
+
+// assertQuorumRacks check every write quorum of the ensemble on distinct racks
+func assertQuorumRacks(t *testing.T, resolver RackResolver, ensemble []string, writeQuorumSize int) {
+	for entryID := range ensemble {
+		var racks []string
+		for _, index := range newWriteSet(int64(entryID), len(ensemble), writeQuorumSize) {
+			racks = append(racks, resolver.Resolve(ensemble[index]))
+		}
+		assert.ElementsMatch(t, racks, uniqueStrings(racks), "ensemble %v", ensemble)
+	}
+}
+
+func TestRackAwarePlacementPolicy_NewEnsemble(t *testing.T) {
+	resolver := testRacks(6, 3)
+	policy := NewRackAwarePlacementPolicy(resolver)
+	policy.OnClusterChanged(testBookies(6), nil)
+
+	for i := 0; i < 50; i++ {
+		ensemble, err := policy.NewEnsemble(6, 3, 2, nil)
+		assert.NoError(t, err)
+		assertQuorumRacks(t, resolver, ensemble, 3)
+
+		ensemble, err = policy.NewEnsemble(4, 2, 2, []string{"127.0.0.1:8000"})
+		assert.NoError(t, err)
+		assert.NotContains(t, ensemble, "127.0.0.1:8000")
+		assertQuorumRacks(t, resolver, ensemble, 2)
+	}
+
+	_, err := policy.NewEnsemble(7, 3, 2, nil)
+	assert.ErrorIs(t, err, ErrNotEnoughBookies)
+}
+
+func TestRackAwarePlacementPolicy_NotEnoughRacks(t *testing.T) {
+	resolver := testRacks(4, 2)
+	policy := NewRackAwarePlacementPolicy(resolver)
+	policy.OnClusterChanged(testBookies(4), nil)
+
+	// a write quorum of 3 can't be on 2 racks, both racks are still used
+	ensemble, err := policy.NewEnsemble(3, 3, 2, nil)
+	assert.NoError(t, err)
+	var racks []string
+	for _, bookie := range ensemble {
+		racks = append(racks, resolver.Resolve(bookie))
+	}
+	assert.Len(t, uniqueStrings(racks), 2)
+
+	// bookies not resolved are on the default rack
+	policy = NewRackAwarePlacementPolicy(RackResolverFunc(func(string) string { return "" }))
+	policy.OnClusterChanged(testBookies(3), nil)
+	ensemble, err = policy.NewEnsemble(3, 2, 2, nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, testBookies(3), ensemble)
+	assert.Equal(t, defaultRack, policy.rack(ensemble[0]))
+}
+
+func TestRackAwarePlacementPolicy_ReplaceBookie(t *testing.T) {
+	resolver := StaticRackResolver{
+		"127.0.0.1:8000": "/region/rack-0",
+		"127.0.0.1:8001": "/region/rack-1",
+		"127.0.0.1:8002": "/region/rack-2",
+		"127.0.0.1:8003": "/region/rack-1",
+		"127.0.0.1:8004": "/region/rack-0",
+		"127.0.0.1:8005": "rack-3",
+	}
+	policy := NewRackAwarePlacementPolicy(resolver)
+	policy.OnClusterChanged(testBookies(5), nil)
+
+	// the replacement of 8002 shares a quorum with both 8000 and 8001
+	ensemble := testBookies(3)
+	bookie, err := policy.ReplaceBookie(3, 3, 2, ensemble, ensemble[2], nil)
+	assert.NoError(t, err)
+	assert.Contains(t, []string{"127.0.0.1:8003", "127.0.0.1:8004"}, bookie)
+
+	policy.OnClusterChanged(testBookies(6), nil)
+	for i := 0; i < 20; i++ {
+		bookie, err = policy.ReplaceBookie(3, 3, 2, ensemble, ensemble[2], nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:8005", bookie)
+	}
+	assert.Equal(t, "/rack-3", policy.rack("127.0.0.1:8005"))
+
+	_, err = policy.ReplaceBookie(3, 3, 2, ensemble, ensemble[2], testBookies(6)[3:])
+	assert.ErrorIs(t, err, ErrNotEnoughBookies)
+}
+
+func TestQuorumNeighbors(t *testing.T) {
+	assert.ElementsMatch(t, []int{1, 4}, quorumNeighbors(5, 0, 2))
+	assert.ElementsMatch(t, []int{0, 1, 3, 4}, quorumNeighbors(5, 2, 3))
+	assert.ElementsMatch(t, []int{0, 2}, quorumNeighbors(3, 1, 5))
+	assert.Empty(t, quorumNeighbors(3, 1, 1))
+}
@@ -0,0 +1,133 @@
+package bookkeeper
+
+import (
+	"fmt"
+	"strings"
+)
+
+const defaultRegion = "default-region"
+
+// RegionAwarePlacementPolicy spread ensembles across regions, every write
+// quorum spans at least minRegions regions and distinct racks in them where
+// possible. Bookies of the local region are read first.
+type RegionAwarePlacementPolicy struct {
+	racks       *RackAwarePlacementPolicy
+	localRegion string
+	minRegions  int
+}
+
+// NewRegionAwarePlacementPolicy return policy placing every write quorum on at
+// least minRegions regions, bookies are located by resolver as /region/rack,
+// and the ones in localRegion are preferred for reads
+func NewRegionAwarePlacementPolicy(resolver RackResolver, localRegion string, minRegions int) *RegionAwarePlacementPolicy {
+	if minRegions < 1 {
+		minRegions = 1
+	}
+	return &RegionAwarePlacementPolicy{
+		racks:       NewRackAwarePlacementPolicy(resolver),
+		localRegion: strings.Trim(localRegion, "/"),
+		minRegions:  minRegions,
+	}
+}
+
+func (p *RegionAwarePlacementPolicy) OnClusterChanged(writable, readOnly []string) {
+	p.racks.OnClusterChanged(writable, readOnly)
+}
+
+func (p *RegionAwarePlacementPolicy) NewEnsemble(ensembleSize, writeQuorumSize, ackQuorumSize int, excluded []string) ([]string, error) {
+	candidates := p.racks.random.candidates(excluded)
+	if len(candidates) < ensembleSize {
+		return nil, ErrNotEnoughBookies
+	}
+
+	ensemble := make([]string, ensembleSize)
+	for index := range ensemble {
+		i := pickBookie(candidates, ensemble, index, writeQuorumSize, p.region, p.racks.rack)
+		ensemble[index] = candidates[i]
+		candidates = append(candidates[:i], candidates[i+1:]...)
+	}
+
+	if err := p.checkRegions(ensemble, -1, writeQuorumSize); err != nil {
+		return nil, err
+	}
+	return ensemble, nil
+}
+
+func (p *RegionAwarePlacementPolicy) ReplaceBookie(ensembleSize, writeQuorumSize, ackQuorumSize int, ensemble []string, bookie string, excluded []string) (string, error) {
+	candidates := p.racks.random.candidates(append(append([]string{}, excluded...), ensemble...))
+	if len(candidates) == 0 {
+		return "", ErrNotEnoughBookies
+	}
+
+	index := indexString(ensemble, bookie)
+	if index < 0 {
+		return candidates[0], nil
+	}
+	newEnsemble := append([]string{}, ensemble...)
+	newEnsemble[index] = ""
+	newEnsemble[index] = candidates[pickBookie(candidates, newEnsemble, index, writeQuorumSize, p.region, p.racks.rack)]
+
+	if err := p.checkRegions(newEnsemble, index, writeQuorumSize); err != nil {
+		return "", err
+	}
+	return newEnsemble[index], nil
+}
+
+// ReorderReadSequence read available bookies of the local region first, then
+// the ones of other regions, bookies left the cluster are read last
+func (p *RegionAwarePlacementPolicy) ReorderReadSequence(ensemble []string, writeSet []int) []int {
+	return reorderReadSequence(writeSet, func(index int) int {
+		bookie := ensemble[index]
+		tier := p.racks.random.readTier(bookie)
+		if tier == 2 {
+			return 4
+		}
+		if p.region(bookie) != p.localRegion {
+			tier += 2
+		}
+		return tier
+	})
+}
+
+// checkRegions check the write quorums with the bookie at index span enough
+// regions, all write quorums are checked if index is -1. At most
+// writeQuorumSize regions are required.
+func (p *RegionAwarePlacementPolicy) checkRegions(ensemble []string, index, writeQuorumSize int) error {
+	minRegions := p.minRegions
+	if minRegions > writeQuorumSize {
+		minRegions = writeQuorumSize
+	}
+
+	for entryID := range ensemble {
+		writeSet := newWriteSet(int64(entryID), len(ensemble), writeQuorumSize)
+		if index >= 0 && !containsInt(writeSet, index) {
+			continue
+		}
+
+		var regions []string
+		for _, i := range writeSet {
+			if region := p.region(ensemble[i]); !containsString(regions, region) {
+				regions = append(regions, region)
+			}
+		}
+		if len(regions) < minRegions {
+			return fmt.Errorf("%w: write quorum on %d regions, %d required", ErrNotEnoughBookies, len(regions), minRegions)
+		}
+	}
+	return nil
+}
+
+func (p *RegionAwarePlacementPolicy) region(bookie string) string {
+	region, _ := splitLocation(p.racks.rack(bookie))
+	return region
+}
+
+// splitLocation split /region/rack, a location of a single level is a rack
+// in the default region
+func splitLocation(location string) (region, rack string) {
+	parts := strings.SplitN(strings.Trim(location, "/"), "/", 2)
+	if len(parts) < 2 {
+		return defaultRegion, parts[0]
+	}
+	return parts[0], parts[1]
+}
@@ -0,0 +1,102 @@
+package bookkeeper
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testRegions place bookies of testBookies round robin on n regions, with
+// two racks in every region
+func testRegions(bookieNum, n int) StaticRackResolver {
+	locations := make(StaticRackResolver)
+	for i, bookie := range testBookies(bookieNum) {
+		locations[bookie] = fmt.Sprintf("/region-%d/rack-%d", i%n, i/n%2)
+	}
+	return locations
+}
+
+func quorumRegions(policy *RegionAwarePlacementPolicy, ensemble []string, entryID int64, writeQuorumSize int) []string {
+	var regions []string
+	for _, index := range newWriteSet(entryID, len(ensemble), writeQuorumSize) {
+		regions = append(regions, policy.region(ensemble[index]))
+	}
+	return uniqueStrings(regions)
+}
+
+func TestRegionAwarePlacementPolicy_NewEnsemble(t *testing.T) {
+	policy := NewRegionAwarePlacementPolicy(testRegions(12, 3), "region-0", 3)
+	policy.OnClusterChanged(testBookies(12), nil)
+
+	for i := 0; i < 50; i++ {
+		ensemble, err := policy.NewEnsemble(6, 3, 2, nil)
+		assert.NoError(t, err)
+		for entryID := range ensemble {
+			assert.Len(t, quorumRegions(policy, ensemble, int64(entryID), 3), 3, "ensemble %v", ensemble)
+		}
+
+		// min regions is bounded by the write quorum
+		ensemble, err = policy.NewEnsemble(4, 2, 2, nil)
+		assert.NoError(t, err)
+		for entryID := range ensemble {
+			assert.Len(t, quorumRegions(policy, ensemble, int64(entryID), 2), 2, "ensemble %v", ensemble)
+		}
+	}
+
+	// bookies of region-1 and region-2 are excluded
+	var excluded []string
+	for i, bookie := range testBookies(12) {
+		if i%3 != 0 {
+			excluded = append(excluded, bookie)
+		}
+	}
+	_, err := policy.NewEnsemble(3, 3, 2, excluded)
+	assert.ErrorIs(t, err, ErrNotEnoughBookies)
+
+	policy = NewRegionAwarePlacementPolicy(testRegions(12, 3), "region-0", 0)
+	policy.OnClusterChanged(testBookies(12), nil)
+	ensemble, err := policy.NewEnsemble(3, 3, 2, excluded)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"region-0"}, quorumRegions(policy, ensemble, 0, 3))
+}
+
+func TestRegionAwarePlacementPolicy_ReplaceBookie(t *testing.T) {
+	policy := NewRegionAwarePlacementPolicy(testRegions(9, 3), "region-0", 3)
+	policy.OnClusterChanged(testBookies(9), nil)
+
+	// the replacement of 8001 must be in region-1
+	ensemble := testBookies(3)
+	for i := 0; i < 20; i++ {
+		bookie, err := policy.ReplaceBookie(3, 3, 2, ensemble, ensemble[1], nil)
+		assert.NoError(t, err)
+		assert.Contains(t, []string{"127.0.0.1:8004", "127.0.0.1:8007"}, bookie)
+	}
+
+	_, err := policy.ReplaceBookie(3, 3, 2, ensemble, ensemble[1], []string{"127.0.0.1:8004", "127.0.0.1:8007"})
+	assert.ErrorIs(t, err, ErrNotEnoughBookies)
+}
+
+func TestRegionAwarePlacementPolicy_ReorderReadSequence(t *testing.T) {
+	policy := NewRegionAwarePlacementPolicy(testRegions(6, 3), "/region-1/", 2)
+	policy.OnClusterChanged(testBookies(4)[1:], []string{"127.0.0.1:8004"})
+
+	// local writable, local read only, remote writable, left the cluster
+	ensemble := []string{"127.0.0.1:8000", "127.0.0.1:8002", "127.0.0.1:8004", "127.0.0.1:8001"}
+	writeSet := []int{0, 1, 2, 3}
+	assert.Equal(t, []int{3, 2, 1, 0}, policy.ReorderReadSequence(ensemble, writeSet))
+	assert.Equal(t, []int{0, 1, 2, 3}, writeSet)
+}
+
+func TestSplitLocation(t *testing.T) {
+	region, rack := splitLocation("/region-a/rack-1")
+	assert.Equal(t, "region-a", region)
+	assert.Equal(t, "rack-1", rack)
+
+	region, rack = splitLocation("/rack-1")
+	assert.Equal(t, defaultRegion, region)
+	assert.Equal(t, "rack-1", rack)
+
+	region, _ = splitLocation(defaultRack)
+	assert.Equal(t, defaultRegion, region)
+}
@@ -0,0 +1,133 @@
+package bookkeeper
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chrisxrepo/bookkeeper-client-go/pb"
+	"github.com/stretchr/testify/assert"
+)
+
+// newOrderedPlacementPolicy return random policy choosing bookies in the order
+// they are listed, so tests know the ensembles
+func newOrderedPlacementPolicy() *RandomPlacementPolicy {
+	return &RandomPlacementPolicy{shuffle: func(int, func(i, j int)) {}}
+}
+
+func uniqueStrings(strs []string) []string {
+	var unique []string
+	for _, str := range strs {
+		if !containsString(unique, str) {
+			unique = append(unique, str)
+		}
+	}
+	return unique
+}
+
+func TestRandomPlacementPolicy_NewEnsemble(t *testing.T) {
+	policy := NewRandomPlacementPolicy()
+	policy.OnClusterChanged(testBookies(6), []string{"127.0.0.1:8006"})
+
+	chosen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		ensemble, err := policy.NewEnsemble(3, 2, 2, []string{"127.0.0.1:8000"})
+		assert.NoError(t, err)
+		assert.Len(t, ensemble, 3)
+		assert.NotContains(t, ensemble, "127.0.0.1:8000")
+		assert.NotContains(t, ensemble, "127.0.0.1:8006")
+		assert.ElementsMatch(t, ensemble, uniqueStrings(ensemble))
+		for _, bookie := range ensemble {
+			chosen[bookie] = true
+		}
+	}
+	// all writable bookies not excluded are used
+	assert.Len(t, chosen, 5)
+
+	_, err := policy.NewEnsemble(6, 2, 2, []string{"127.0.0.1:8000"})
+	assert.ErrorIs(t, err, ErrNotEnoughBookies)
+}
+
+func TestRandomPlacementPolicy_ReplaceBookie(t *testing.T) {
+	policy := NewRandomPlacementPolicy()
+	policy.OnClusterChanged(testBookies(5), nil)
+
+	ensemble := testBookies(3)
+	for i := 0; i < 20; i++ {
+		bookie, err := policy.ReplaceBookie(3, 2, 2, ensemble, ensemble[0], nil)
+		assert.NoError(t, err)
+		assert.NotContains(t, ensemble, bookie)
+	}
+
+	bookie, err := policy.ReplaceBookie(3, 2, 2, ensemble, ensemble[0], []string{"127.0.0.1:8003"})
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8004", bookie)
+
+	_, err = policy.ReplaceBookie(3, 2, 2, ensemble, ensemble[0], []string{"127.0.0.1:8003", "127.0.0.1:8004"})
+	assert.ErrorIs(t, err, ErrNotEnoughBookies)
+}
+
+func TestRandomPlacementPolicy_ReorderReadSequence(t *testing.T) {
+	policy := NewRandomPlacementPolicy()
+	policy.OnClusterChanged([]string{"127.0.0.1:8002"}, []string{"127.0.0.1:8000"})
+
+	// writable first, then read only, then bookies left the cluster
+	ensemble := testBookies(3)
+	writeSet := []int{0, 1, 2}
+	assert.Equal(t, []int{2, 0, 1}, policy.ReorderReadSequence(ensemble, writeSet))
+	assert.Equal(t, []int{0, 1, 2}, writeSet)
+}
+
+func TestBookKeeper_Quarantine(t *testing.T) {
+	bk := newTestBookKeeper(t, 4, funcClient{})
+	metadata := &Metadata{ensembleSize: 3, writeQuorumSize: 2, ackQuorumSize: 2}
+
+	// the failed bookie is avoided while there are other bookies
+	ensemble := testBookies(3)
+	replacement, err := bk.replaceBookie(metadata, ensemble, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8003", replacement)
+
+	ensemble, err = bk.newEnsemble(3, 2, 2)
+	assert.NoError(t, err)
+	assert.NotContains(t, ensemble, "127.0.0.1:8000")
+
+	// quarantined bookies are used if there are not enough others
+	ensemble, err = bk.newEnsemble(4, 2, 2)
+	assert.NoError(t, err)
+	assert.Contains(t, ensemble, "127.0.0.1:8000")
+
+	// released once the quarantine time passes
+	bk.quarantine.period = time.Millisecond
+	bk.quarantine.add("127.0.0.1:8000")
+	time.Sleep(5 * time.Millisecond)
+	assert.Empty(t, bk.quarantine.list())
+	ensemble, err = bk.newEnsemble(3, 2, 2)
+	assert.NoError(t, err)
+	assert.Contains(t, ensemble, "127.0.0.1:8000")
+}
+
+func TestBookKeeper_ReadSequence(t *testing.T) {
+	var (
+		bookies = newMemoryBookies()
+		lock    sync.Mutex
+		reads   []string
+	)
+	bk := newTestBookKeeper(t, 3, funcClient{add: bookies.add, read: func(addr string, entryID int64) ([]byte, error) {
+		lock.Lock()
+		reads = append(reads, addr)
+		lock.Unlock()
+		return bookies.read(addr, entryID)
+	}})
+
+	ledger, err := bk.CreateLeadger(context.Background(), 3, 3, 3, nil, pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+	assert.NoError(t, ledger.AddEntry(context.Background(), []byte("hello")))
+
+	// the read only bookie is read after the writable ones
+	bk.zk.setReadOnlyBookies([]string{"127.0.0.1:8000"})
+	_, err = ledger.ReadEntries(context.Background(), 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:8001"}, reads)
+}
@@ -0,0 +1,137 @@
+package bookkeeper
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+const defaultMaxWeightMultiple = 3
+
+// BookieInfoAware is implemented by placement policies using the disk usage
+// of bookies, BookKeeper queries the writable bookies every
+// Config.BookieInfoInterval and once bookies join
+type BookieInfoAware interface {
+	UpdateBookieInfo(bookie string, info BookieInfo)
+}
+
+// WeightedPlacementPolicy choose bookies randomly weighted by free disk space,
+// so new bookies fill up instead of staying empty. Bookies are read as
+// RandomPlacementPolicy does.
+type WeightedPlacementPolicy struct {
+	random      *RandomPlacementPolicy
+	maxMultiple float64
+
+	lock      sync.RWMutex
+	freeSpace map[string]int64
+}
+
+// NewWeightedPlacementPolicy return policy weighting bookies by free disk
+// space, the weight of a bookie is capped at maxMultiple times the average, so
+// an empty bookie doesn't take all new ledgers, default 3
+func NewWeightedPlacementPolicy(maxMultiple float64) *WeightedPlacementPolicy {
+	if maxMultiple <= 0 {
+		maxMultiple = defaultMaxWeightMultiple
+	}
+	return &WeightedPlacementPolicy{
+		random:      NewRandomPlacementPolicy(),
+		maxMultiple: maxMultiple,
+		freeSpace:   make(map[string]int64),
+	}
+}
+
+func (p *WeightedPlacementPolicy) UpdateBookieInfo(bookie string, info BookieInfo) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.freeSpace[bookie] = info.FreeDiskSpace
+}
+
+func (p *WeightedPlacementPolicy) OnClusterChanged(writable, readOnly []string) {
+	p.lock.Lock()
+	for bookie := range p.freeSpace {
+		if !containsString(writable, bookie) {
+			delete(p.freeSpace, bookie)
+		}
+	}
+	p.lock.Unlock()
+
+	p.random.OnClusterChanged(writable, readOnly)
+}
+
+func (p *WeightedPlacementPolicy) NewEnsemble(ensembleSize, writeQuorumSize, ackQuorumSize int, excluded []string) ([]string, error) {
+	candidates := p.candidates(excluded)
+	if len(candidates) < ensembleSize {
+		return nil, ErrNotEnoughBookies
+	}
+	return candidates[:ensembleSize], nil
+}
+
+func (p *WeightedPlacementPolicy) ReplaceBookie(ensembleSize, writeQuorumSize, ackQuorumSize int, ensemble []string, bookie string, excluded []string) (string, error) {
+	candidates := p.candidates(append(append([]string{}, excluded...), ensemble...))
+	if len(candidates) == 0 {
+		return "", ErrNotEnoughBookies
+	}
+	return candidates[0], nil
+}
+
+func (p *WeightedPlacementPolicy) ReorderReadSequence(ensemble []string, writeSet []int) []int {
+	return p.random.ReorderReadSequence(ensemble, writeSet)
+}
+
+// candidates return writable bookies not excluded in weighted random order,
+// a bookie is ahead of another with the probability of its share of their
+// weights
+func (p *WeightedPlacementPolicy) candidates(excluded []string) []string {
+	var (
+		candidates = p.random.candidates(excluded)
+		weights    = p.weights(candidates)
+		keys       = make(map[string]float64, len(candidates))
+	)
+	for i, bookie := range candidates {
+		// exponential keys of rate weight sort as weighted sampling
+		keys[bookie] = math.Inf(1)
+		if weights[i] > 0 {
+			keys[bookie] = rand.ExpFloat64() / weights[i]
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return keys[candidates[i]] < keys[candidates[j]]
+	})
+	return candidates
+}
+
+// weights return free disk space of the bookies capped at maxMultiple times
+// the average, bookies not queried yet weigh the average
+func (p *WeightedPlacementPolicy) weights(bookies []string) []float64 {
+	var (
+		weights = make([]float64, len(bookies))
+		total   float64
+		known   int
+	)
+	p.lock.RLock()
+	for i, bookie := range bookies {
+		weights[i] = -1
+		if freeSpace, ok := p.freeSpace[bookie]; ok {
+			weights[i] = float64(freeSpace)
+			total += weights[i]
+			known++
+		}
+	}
+	p.lock.RUnlock()
+
+	average := 1.0
+	if known > 0 {
+		average = total / float64(known)
+	}
+	for i, weight := range weights {
+		switch {
+		case weight < 0:
+			weights[i] = average
+		case average > 0 && weight > average*p.maxMultiple:
+			weights[i] = average * p.maxMultiple
+		}
+	}
+	return weights
+}
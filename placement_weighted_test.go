@@ -0,0 +1,107 @@
+package bookkeeper
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countFirst count how many times every bookie is chosen as a single bookie
+// ensemble
+func countFirst(t *testing.T, policy EnsemblePlacementPolicy, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		ensemble, err := policy.NewEnsemble(1, 1, 1, nil)
+		assert.NoError(t, err)
+		counts[ensemble[0]]++
+	}
+	return counts
+}
+
+func TestWeightedPlacementPolicy_FreeSpace(t *testing.T) {
+	policy := NewWeightedPlacementPolicy(100)
+	policy.OnClusterChanged(testBookies(2), nil)
+
+	// bookies are chosen uniformly before their free space is known
+	counts := countFirst(t, policy, 2000)
+	assert.InDelta(t, 1000, counts["127.0.0.1:8000"], 200)
+
+	policy.UpdateBookieInfo("127.0.0.1:8000", BookieInfo{FreeDiskSpace: 100})
+	policy.UpdateBookieInfo("127.0.0.1:8001", BookieInfo{FreeDiskSpace: 900})
+	counts = countFirst(t, policy, 2000)
+	assert.InDelta(t, 1800, counts["127.0.0.1:8001"], 150)
+
+	// all bookies are still chosen when needed
+	ensemble, err := policy.NewEnsemble(2, 2, 2, nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, testBookies(2), ensemble)
+	bookie, err := policy.ReplaceBookie(1, 1, 1, []string{"127.0.0.1:8001"}, "127.0.0.1:8001", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8000", bookie)
+	_, err = policy.NewEnsemble(2, 2, 2, []string{"127.0.0.1:8000"})
+	assert.ErrorIs(t, err, ErrNotEnoughBookies)
+}
+
+func TestWeightedPlacementPolicy_MaxMultiple(t *testing.T) {
+	policy := NewWeightedPlacementPolicy(2)
+	policy.OnClusterChanged(testBookies(5), nil)
+	for _, bookie := range testBookies(3) {
+		policy.UpdateBookieInfo(bookie, BookieInfo{FreeDiskSpace: 100})
+	}
+
+	// the empty bookie weighs at most 2 times the average 325, the bookie not
+	// queried weighs the average, the weights are 100*3, 650 and 325
+	policy.UpdateBookieInfo("127.0.0.1:8003", BookieInfo{FreeDiskSpace: 1000})
+	counts := countFirst(t, policy, 3000)
+	assert.InDelta(t, 1529, counts["127.0.0.1:8003"], 150)
+	assert.InDelta(t, 765, counts["127.0.0.1:8004"], 120)
+
+	// bookies left are forgotten
+	policy.OnClusterChanged(testBookies(3), nil)
+	assert.NotContains(t, policy.freeSpace, "127.0.0.1:8003")
+}
+
+func TestBookKeeper_BookieInfo(t *testing.T) {
+	var (
+		queries atomic.Int64
+		policy  = NewWeightedPlacementPolicy(0)
+	)
+	bk := newTestBookKeeperConfig(t, &Config{PlacementPolicy: policy, BookieInfoInterval: time.Hour}, 3, funcClient{
+		info: func(addr string) (BookieInfo, error) {
+			queries.Add(1)
+			if addr == "127.0.0.1:8002" {
+				return BookieInfo{}, errors.New("mock bookie info failed")
+			}
+			return BookieInfo{TotalDiskCapacity: 1000, FreeDiskSpace: 500}, nil
+		},
+	})
+
+	freeSpace := func(bookie string) (int64, bool) {
+		policy.lock.RLock()
+		defer policy.lock.RUnlock()
+		freeSpace, ok := policy.freeSpace[bookie]
+		return freeSpace, ok
+	}
+
+	// writable bookies are queried on start
+	assert.Eventually(t, func() bool { return queries.Load() == 3 }, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool {
+		_, ok := freeSpace("127.0.0.1:8001")
+		return ok
+	}, time.Second, time.Millisecond)
+	_, ok := freeSpace("127.0.0.1:8002")
+	assert.False(t, ok)
+
+	// joined bookies are queried at once
+	bk.zk.zkConn.Create("/ledgers/available/127.0.0.1:8003", nil, 0, nil)
+	assert.Eventually(t, func() bool {
+		space, ok := freeSpace("127.0.0.1:8003")
+		return ok && space == 500
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, bk.Close(context.Background()))
+}
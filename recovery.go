@@ -0,0 +1,239 @@
+package bookkeeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/chrisxrepo/bookkeeper-client-go/pb"
+)
+
+// recover fence the ledger on the bookies of the last ensemble, re-replicate
+// the entries after the last add confirmed which may be acknowledged to the
+// crashed writer, then close the ledger
+func (l *normalLedger) recover(ctx context.Context) error {
+	if l.metadata.state == pb.LedgerMetadataFormat_OPEN {
+		metadata := l.metadata.clone()
+		metadata.state = pb.LedgerMetadataFormat_IN_RECOVERY
+		if err := l.bookkeeper.updateLedgerMetadata(ctx, metadata); err != nil {
+			return err
+		}
+		l.metadata = metadata
+	}
+
+	lastAddConfirmed, err := l.fenceLastAddConfirmed(ctx)
+	if err != nil {
+		return err
+	}
+
+	var length int64
+	if lastAddConfirmed >= 0 {
+		if _, length, err = l.recoveryReadEntry(ctx, lastAddConfirmed); err != nil {
+			return fmt.Errorf("Read last add confirmed entry %d failed: %w", lastAddConfirmed, err)
+		}
+	}
+
+	lastEntryID := lastAddConfirmed
+	for entryID := lastAddConfirmed + 1; ; entryID++ {
+		frame, entryLength, err := l.recoveryReadEntry(ctx, entryID)
+		if errors.Is(err, ErrNoSuchEntry) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := l.recoveryAddEntry(ctx, entryID, frame); err != nil {
+			return err
+		}
+		lastEntryID, length = entryID, entryLength
+	}
+
+	metadata := l.metadata.clone()
+	metadata.state = pb.LedgerMetadataFormat_CLOSED
+	metadata.lastEntryID = lastEntryID
+	metadata.length = length
+
+	err = l.bookkeeper.updateLedgerMetadata(ctx, metadata)
+	if errors.Is(err, ErrMetadataVersionConflict) {
+		// another client may have recovered the ledger at the same time
+		current, cerr := l.bookkeeper.readLedgerMetadata(ctx, metadata.ledgerID)
+		if cerr != nil {
+			return cerr
+		}
+		if current.state != pb.LedgerMetadataFormat_CLOSED {
+			return err
+		}
+		metadata, err = current, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	l.setClosed(metadata)
+	l.bookkeeper.cfg.logger().Info("ledger recovered", "ledgerId", l.ledgerID,
+		"lastEntryId", metadata.lastEntryID, "length", metadata.length)
+	return nil
+}
+
+// fenceLastAddConfirmed fence the ledger on all bookies of the last ensemble
+// and return the max last add confirmed piggybacked in their last entries
+func (l *normalLedger) fenceLastAddConfirmed(ctx context.Context) (int64, error) {
+	type fenceResult struct {
+		index            int
+		lastAddConfirmed int64
+		err              error
+	}
+
+	var (
+		ensemble = l.metadata.lastEnsemble()
+		results  = make(chan fenceResult, len(ensemble))
+	)
+	for i, bookie := range ensemble {
+		go func(index int, bookie string) {
+			result := fenceResult{index: index, lastAddConfirmed: -1}
+			defer func() { results <- result }()
+
+			client, err := l.bookkeeper.clientPool.GetClient(ctx, bookie, l.ledgerID)
+			if err != nil {
+				result.err = err
+				return
+			}
+
+			_, frame, err := client.FenceReadEntry(ctx, l.ledgerID, -1, l.ledgerKey)
+			if errors.Is(err, ErrNoSuchEntry) || errors.Is(err, ErrNoSuchLedger) {
+				return
+			}
+			if err != nil {
+				result.err = err
+				return
+			}
+
+			// the bookie echoes the requested id -1, the id of the last entry
+			// is in its frame
+			_, result.lastAddConfirmed, _, result.err = l.checksum.VerifyDigestAndReturnData(frameEntryID(frame), frame)
+		}(i, bookie)
+	}
+
+	var (
+		responded        = make([]bool, len(ensemble))
+		lastAddConfirmed = int64(-1)
+		lastErr          error
+	)
+	for range ensemble {
+		result := <-results
+		if result.err != nil {
+			lastErr = result.err
+			continue
+		}
+
+		responded[result.index] = true
+		if result.lastAddConfirmed > lastAddConfirmed {
+			lastAddConfirmed = result.lastAddConfirmed
+		}
+	}
+
+	if !quorumCovered(responded, int(l.metadata.writeQuorumSize), int(l.metadata.ackQuorumSize)) {
+		return 0, fmt.Errorf("%w: fence ledger %d, last error: %v", ErrNotEnoughBookies, l.ledgerID, lastErr)
+	}
+	return lastAddConfirmed, nil
+}
+
+// recoveryReadEntry read entry with fencing from bookies of the write set,
+// return ErrNoSuchEntry once enough bookies miss the entry that it can't be
+// acknowledged by an ack quorum
+func (l *normalLedger) recoveryReadEntry(ctx context.Context, entryID int64) ([]byte, int64, error) {
+	var (
+		ensemble  = l.metadata.getEnsemble(entryID)
+		writeSet  = newWriteSet(entryID, int(l.metadata.ensembleSize), int(l.metadata.writeQuorumSize))
+		threshold = int(l.metadata.writeQuorumSize-l.metadata.ackQuorumSize) + 1
+		missed    int
+		lastErr   error
+	)
+	for _, index := range writeSet {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+
+		client, err := l.bookkeeper.clientPool.GetClient(ctx, ensemble[index], l.ledgerID)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		_, frame, err := client.FenceReadEntry(ctx, l.ledgerID, entryID, l.ledgerKey)
+		if errors.Is(err, ErrNoSuchEntry) || errors.Is(err, ErrNoSuchLedger) {
+			if missed++; missed >= threshold {
+				return nil, 0, ErrNoSuchEntry
+			}
+			continue
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		_, _, length, err := l.checksum.VerifyDigestAndReturnData(entryID, frame)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return frame, length, nil
+	}
+
+	if lastErr == nil {
+		lastErr = ErrNoSuchEntry
+	}
+	return nil, 0, fmt.Errorf("Recovery read entry %d failed: %w", entryID, lastErr)
+}
+
+// recoveryAddEntry write the entry frame to the write set and wait ack quorum
+func (l *normalLedger) recoveryAddEntry(ctx context.Context, entryID int64, frame []byte) error {
+	var (
+		ensemble  = l.metadata.getEnsemble(entryID)
+		writeSet  = newWriteSet(entryID, int(l.metadata.ensembleSize), int(l.metadata.writeQuorumSize))
+		ackQuorum = int(l.metadata.ackQuorumSize)
+		maxFailed = len(writeSet) - ackQuorum
+		results   = make(chan error, len(writeSet))
+		acked     int
+		failed    int
+	)
+
+	for _, index := range writeSet {
+		go func(bookie string) {
+			client, err := l.bookkeeper.clientPool.GetClient(ctx, bookie, l.ledgerID)
+			if err == nil {
+				err = client.RecoveryAddEntry(ctx, l.ledgerID, entryID, l.ledgerKey, frame)
+			}
+			results <- err
+		}(ensemble[index])
+	}
+
+	for range writeSet {
+		if err := <-results; err != nil {
+			if failed++; failed > maxFailed {
+				return err
+			}
+		} else if acked++; acked >= ackQuorum {
+			return nil
+		}
+	}
+	return nil
+}
+
+// quorumCovered check that every write quorum of the ensemble has enough
+// responses, so no entry can be acknowledged without being seen
+func quorumCovered(responded []bool, writeQuorumSize, ackQuorumSize int) bool {
+	for i := range responded {
+		count := 0
+		for j := 0; j < writeQuorumSize; j++ {
+			if responded[(i+j)%len(responded)] {
+				count++
+			}
+		}
+		if count < writeQuorumSize-ackQuorumSize+1 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package bookkeeper
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chrisxrepo/bookkeeper-client-go/pb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuorumCovered(t *testing.T) {
+	assert.True(t, quorumCovered([]bool{true, true, true}, 2, 2))
+	assert.True(t, quorumCovered([]bool{true, false, true}, 2, 2))
+	assert.False(t, quorumCovered([]bool{true, false, false}, 2, 2))
+	assert.False(t, quorumCovered([]bool{true, false, true}, 2, 1))
+	assert.True(t, quorumCovered([]bool{true, true, false, true, true}, 3, 2))
+	assert.False(t, quorumCovered([]bool{true, false, true, false, true}, 3, 2))
+}
+
+func TestLedger_RecoveryReadEntry(t *testing.T) {
+	bookies := newMemoryBookies()
+	client := funcClient{add: bookies.add, read: bookies.read, last: bookies.last}
+	writer := newTestLedger(t, 3, 3, 2, client)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, writer.AddEntry(context.Background(), []byte("hello")))
+	}
+
+	// the writer crashed after entry 10 reached only one bookie
+	frame, err := writer.checksum.PackageForSending(10, 9, 55, []byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, bookies.add("127.0.0.1:8000", 10, frame))
+
+	metadata := writer.metadata.clone()
+	metadata.state = pb.LedgerMetadataFormat_IN_RECOVERY
+	ledger, err := newNormalLedger(writer.bookkeeper, metadata)
+	assert.NoError(t, err)
+	recovering := ledger.(*normalLedger)
+
+	lastAddConfirmed, err := recovering.fenceLastAddConfirmed(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9), lastAddConfirmed)
+
+	_, length, err := recovering.recoveryReadEntry(context.Background(), 9)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(50), length)
+
+	// entry 10 is read from bookie 1, 2 and 0 in turn, the first two miss it
+	_, _, err = recovering.recoveryReadEntry(context.Background(), 10)
+	assert.ErrorIs(t, err, ErrNoSuchEntry)
+
+	// entry 10 on bookie 1 is read before the bookies which miss it
+	assert.NoError(t, bookies.add("127.0.0.1:8001", 10, frame))
+	frame, length, err = recovering.recoveryReadEntry(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(55), length)
+
+	assert.NoError(t, recovering.recoveryAddEntry(context.Background(), 10, frame))
+	assert.Eventually(t, func() bool {
+		_, err := bookies.read("127.0.0.1:8002", 10)
+		return err == nil
+	}, time.Second, time.Millisecond)
+}
+
+func TestLedger_Recover(t *testing.T) {
+	bookies := newMemoryBookies()
+	client := funcClient{add: bookies.add, read: bookies.read, last: bookies.last}
+	writer := newTestLedger(t, 3, 3, 2, client)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, writer.AddEntry(context.Background(), []byte("hello")))
+	}
+
+	// entry 10 reached bookie 1 only, which is read first in its write set
+	frame, err := writer.checksum.PackageForSending(10, 9, 55, []byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, bookies.add("127.0.0.1:8001", 10, frame))
+
+	ledger, err := writer.bookkeeper.OpenLedger(context.Background(), writer.GetLedgerID(), nil, pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), ledger.GetLastAddConfirmed())
+
+	metadata, err := writer.bookkeeper.readLedgerMetadata(context.Background(), writer.GetLedgerID())
+	assert.NoError(t, err)
+	assert.Equal(t, pb.LedgerMetadataFormat_CLOSED, metadata.state)
+	assert.Equal(t, int64(10), metadata.lastEntryID)
+	assert.Equal(t, int64(55), metadata.length)
+
+	entries, err := ledger.ReadEntries(context.Background(), 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 11)
+
+	// the writer can't close the recovered ledger with a different end
+	assert.ErrorIs(t, writer.Close(context.Background()), ErrMetadataVersionConflict)
+}
+
+func TestOpenLedger(t *testing.T) {
+	var (
+		bookies = newMemoryBookies()
+		fenced  atomic.Bool
+	)
+	bk := newTestBookKeeper(t, 3, funcClient{
+		// fenced bookies only accept adds of recovery
+		add: func(addr string, entryID int64, payload []byte) error {
+			if fenced.Load() {
+				return statusError(pb.StatusCode_EFENCED)
+			}
+			return bookies.add(addr, entryID, payload)
+		},
+		recoveryAdd: bookies.add,
+		read:        bookies.read,
+		last: func(addr string) (int64, []byte, error) {
+			// the last entry is read by fencing on recovery
+			fenced.Store(true)
+			return bookies.last(addr)
+		},
+	})
+
+	ledger, err := bk.CreateLeadger(context.Background(), 3, 2, 2, []byte("pwd"), pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+	assert.NoError(t, ledger.AddEntry(context.Background(), []byte("hello bookkeeper")))
+
+	_, err = bk.OpenLedger(context.Background(), ledger.GetLedgerID(), []byte("wrong"), pb.LedgerMetadataFormat_CRC32)
+	assert.ErrorIs(t, err, ErrUnauthorizedAccess)
+	assert.False(t, fenced.Load())
+
+	opened, err := bk.OpenLedger(context.Background(), ledger.GetLedgerID(), []byte("pwd"), pb.LedgerMetadataFormat_CRC32)
+	assert.NoError(t, err)
+
+	entries, err := opened.ReadEntries(context.Background(), 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello bookkeeper"), entries[0].Data)
+
+	// the writer is fenced
+	assert.ErrorIs(t, ledger.AddEntry(context.Background(), []byte("hello bookkeeper")), ErrLedgerFenced)
+}
@@ -1,49 +1,115 @@
 package bookkeeper
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/url"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/go-zookeeper/zk"
 )
 
+const bookieWatchRetryInterval = time.Second
+
 func NewZookeeper(cfg *Config) (*Zookeeper, error) {
 	addrs, basePath, err := parseZkUri(cfg.BKURI)
 	if err != nil {
 		return nil, err
 	}
 
-	conn, evCh, err := zk.Connect(addrs, cfg.ZKTimeout)
+	conn, evCh, err := zk.Connect(addrs, cfg.ZKTimeout, zk.WithLogger(zkLogger{cfg.logger()}))
 	if err != nil {
 		return nil, err
 	}
 
-	zk := &Zookeeper{
-		zkConn:   conn,
-		bathPath: basePath,
-		idgen:    path.Join(basePath, "idgen", "ID-"),
+	z, err := newZookeeper(conn, evCh, basePath, cfg.logger())
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return z, nil
+}
+
+func newZookeeper(conn zkConn, evCh <-chan zk.Event, basePath string, logger Logger) (*Zookeeper, error) {
+	z := &Zookeeper{
+		zkConn:    conn,
+		logger:    logger,
+		bathPath:  basePath,
+		idgen:     path.Join(basePath, "idgen", "ID-"),
+		done:      make(chan struct{}),
+		listeners: make(map[int]BookieListener),
+
+		readOnlyListeners: make(map[int]BookieListener),
+
+		sessionListeners: make(map[int]SessionListener),
 	}
 
 	bks, _, bkEvent, err := conn.ChildrenW(path.Join(basePath, "/available"))
 	if err != nil {
 		return nil, err
 	}
-	zk.setBookies(bks)
+	z.setBookies(bks)
+	roEvent, roRetry := z.watchReadOnlyBookies()
+
+	z.wg.Add(1)
+	go z.zkEventWatch(evCh, bkEvent, roEvent, roRetry)
+	return z, nil
+}
+
+// zkLogger route logs of the zookeeper connection to Logger
+type zkLogger struct {
+	logger Logger
+}
+
+func (l zkLogger) Printf(format string, args ...any) {
+	l.logger.Info("zookeeper: " + fmt.Sprintf(format, args...))
+}
 
-	go zk.zkEventWatch(evCh, bkEvent)
-	return zk, nil
+// zkConn is the subset of zk.Conn used by Zookeeper
+type zkConn interface {
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Get(path string) ([]byte, *zk.Stat, error)
+	Set(path string, data []byte, version int32) (*zk.Stat, error)
+	ChildrenW(path string) ([]string, *zk.Stat, <-chan zk.Event, error)
+	ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error)
+	Close()
 }
 
+// SessionListener is notified when the session expires and when a new session
+// is established, it's invoked by the watching goroutine and must not block
+type SessionListener func(expired bool)
+
+// BookieListener is notified with the bookies joined and left, it's invoked
+// by the watching goroutine and must not block
+type BookieListener func(joined, left []string)
+
 type Zookeeper struct {
-	zkConn   *zk.Conn
-	bathPath string
-	bookies  atomic.Value //[]string
-	idgen    string
+	zkConn      zkConn
+	logger      Logger
+	bathPath    string
+	bookies     atomic.Value //[]string
+	readOnly    atomic.Value //[]string
+	bookiesLock sync.Mutex   // serialize bookie updates and listeners
+	listeners   map[int]BookieListener
+	listenerID  int
+	idgen       string
+
+	readOnlyListeners map[int]BookieListener
+
+	sessionLock       sync.Mutex
+	sessionExpired    bool
+	sessionListeners  map[int]SessionListener
+	sessionListenerID int
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
 }
 
 func (z *Zookeeper) Bookies() []string {
@@ -53,8 +119,12 @@ func (z *Zookeeper) Bookies() []string {
 	return []string{}
 }
 
-func (z *Zookeeper) LedgerID() (int64, error) {
-	idStr, err := z.zkConn.Create(z.idgen, []byte{}, 3, zk.WorldACL(zk.PermAll))
+func (z *Zookeeper) LedgerID(ctx context.Context) (int64, error) {
+	var idStr string
+	err := withContext(ctx, func() (err error) {
+		idStr, err = z.zkConn.Create(z.idgen, []byte{}, 3, zk.WorldACL(zk.PermAll))
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -62,16 +132,156 @@ func (z *Zookeeper) LedgerID() (int64, error) {
 	return strconv.ParseInt(strings.TrimPrefix(idStr, z.idgen), 10, 0)
 }
 
-func (z *Zookeeper) GetData(p string) ([]byte, error) {
-	bs, _, err := z.zkConn.Get(path.Join(z.bathPath, p))
+func (z *Zookeeper) GetData(ctx context.Context, p string) ([]byte, error) {
+	bs, _, err := z.GetDataVersion(ctx, p)
 	return bs, err
 }
 
-func (z *Zookeeper) SetData(p string, data []byte) error {
-	_, err := z.zkConn.Create(path.Join(z.bathPath, p), data, 0, zk.WorldACL(zk.PermAll))
-	return err
+func (z *Zookeeper) GetDataVersion(ctx context.Context, p string) ([]byte, int32, error) {
+	var (
+		bs   []byte
+		stat *zk.Stat
+	)
+	err := withContext(ctx, func() (err error) {
+		bs, stat, err = z.zkConn.Get(path.Join(z.bathPath, p))
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return bs, stat.Version, nil
+}
+
+func (z *Zookeeper) SetData(ctx context.Context, p string, data []byte) error {
+	return withContext(ctx, func() error {
+		_, err := z.zkConn.Create(path.Join(z.bathPath, p), data, 0, zk.WorldACL(zk.PermAll))
+		return err
+	})
+}
+
+// UpdateData set data if the znode version matches, return the new version
+func (z *Zookeeper) UpdateData(ctx context.Context, p string, data []byte, version int32) (int32, error) {
+	var stat *zk.Stat
+	err := withContext(ctx, func() (err error) {
+		stat, err = z.zkConn.Set(path.Join(z.bathPath, p), data, version)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return stat.Version, nil
+}
+
+// withContext run the zookeeper operation and return once ctx is done, the
+// operation itself can't be cancelled and is bounded by the session timeout,
+// so a write may still be applied after ctx is done
+func withContext(ctx context.Context, op func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- op()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stop watching bookies and close the zookeeper session
+func (z *Zookeeper) Close() error {
+	z.closeOnce.Do(func() {
+		close(z.done)
+		z.zkConn.Close()
+	})
+	z.wg.Wait()
+	return nil
+}
+
+// ReadOnlyBookies return bookies in read only mode, they serve reads only
+func (z *Zookeeper) ReadOnlyBookies() []string {
+	if v := z.readOnly.Load(); v != nil {
+		return v.([]string)
+	}
+	return []string{}
 }
 
+// SessionExpired report whether the session expired and no new session has
+// been established yet
+func (z *Zookeeper) SessionExpired() bool {
+	z.sessionLock.Lock()
+	defer z.sessionLock.Unlock()
+	return z.sessionExpired
+}
+
+// WatchSession register listener notified on session expiry and recovery, the
+// returned function removes the listener
+func (z *Zookeeper) WatchSession(listener SessionListener) (cancel func()) {
+	z.sessionLock.Lock()
+	defer z.sessionLock.Unlock()
+
+	z.sessionListenerID++
+	id := z.sessionListenerID
+	z.sessionListeners[id] = listener
+
+	return func() {
+		z.sessionLock.Lock()
+		defer z.sessionLock.Unlock()
+		delete(z.sessionListeners, id)
+	}
+}
+
+func (z *Zookeeper) setSessionExpired(expired bool) {
+	z.sessionLock.Lock()
+	defer z.sessionLock.Unlock()
+
+	if z.sessionExpired == expired {
+		return
+	}
+	z.sessionExpired = expired
+	if expired {
+		z.logger.Warn("zookeeper session expired")
+	} else {
+		z.logger.Info("zookeeper session established")
+	}
+	for _, listener := range z.sessionListeners {
+		listener(expired)
+	}
+}
+
+// WatchBookies register listener notified on bookie changes, the returned
+// function removes the listener
+func (z *Zookeeper) WatchBookies(listener BookieListener) (cancel func()) {
+	return z.watch(z.listeners, listener)
+}
+
+// WatchReadOnlyBookies register listener notified when bookies turn read only
+// or writable again, the returned function removes the listener
+func (z *Zookeeper) WatchReadOnlyBookies(listener BookieListener) (cancel func()) {
+	return z.watch(z.readOnlyListeners, listener)
+}
+
+func (z *Zookeeper) watch(listeners map[int]BookieListener, listener BookieListener) (cancel func()) {
+	z.bookiesLock.Lock()
+	defer z.bookiesLock.Unlock()
+
+	z.listenerID++
+	id := z.listenerID
+	listeners[id] = listener
+
+	return func() {
+		z.bookiesLock.Lock()
+		defer z.bookiesLock.Unlock()
+		delete(listeners, id)
+	}
+}
+
+// setBookies replace the bookies and notify listeners with the difference
 func (z *Zookeeper) setBookies(strs []string) {
 	bks := make([]string, 0, len(strs))
 	for _, str := range strs {
@@ -79,23 +289,139 @@ func (z *Zookeeper) setBookies(strs []string) {
 			bks = append(bks, str)
 		}
 	}
+
+	z.bookiesLock.Lock()
+	defer z.bookiesLock.Unlock()
+
+	joined, left := diffBookies(z.Bookies(), bks)
 	z.bookies.Store(bks)
+
+	if len(joined) == 0 && len(left) == 0 {
+		return
+	}
+	z.logger.Info("bookies changed", "joined", joined, "left", left)
+	for _, listener := range z.listeners {
+		listener(joined, left)
+	}
 }
 
-func (z *Zookeeper) zkEventWatch(zkCh, bkCh <-chan zk.Event) {
+// setReadOnlyBookies replace the read only bookies and notify listeners with
+// the difference
+func (z *Zookeeper) setReadOnlyBookies(bks []string) {
+	z.bookiesLock.Lock()
+	defer z.bookiesLock.Unlock()
+
+	joined, left := diffBookies(z.ReadOnlyBookies(), bks)
+	z.readOnly.Store(bks)
+
+	if len(joined) == 0 && len(left) == 0 {
+		return
+	}
+	z.logger.Info("read only bookies changed", "joined", joined, "left", left)
+	for _, listener := range z.readOnlyListeners {
+		listener(joined, left)
+	}
+}
+
+// diffBookies return bookies in current not in previous, and the reverse
+func diffBookies(previous, current []string) (joined, left []string) {
+	for _, bk := range current {
+		if !containsString(previous, bk) {
+			joined = append(joined, bk)
+		}
+	}
+	for _, bk := range previous {
+		if !containsString(current, bk) {
+			left = append(left, bk)
+		}
+	}
+	return joined, left
+}
+
+// watchBookies read the available bookies and leave a watch on them
+func (z *Zookeeper) watchBookies() (<-chan zk.Event, <-chan time.Time) {
+	return z.watchChildren(path.Join(z.bathPath, "/available"), false, z.setBookies)
+}
+
+// watchReadOnlyBookies read the read only bookies and leave a watch on them,
+// the path may not exist until a bookie turns read only
+func (z *Zookeeper) watchReadOnlyBookies() (<-chan zk.Event, <-chan time.Time) {
+	return z.watchChildren(path.Join(z.bathPath, "/available/readonly"), true, z.setReadOnlyBookies)
+}
+
+// watchChildren read children of the path and leave a watch on them, a timer
+// is returned to retry if it fails. An optional path not existing has no
+// children, the watch is left to wait it to be created.
+func (z *Zookeeper) watchChildren(p string, optional bool, set func([]string)) (<-chan zk.Event, <-chan time.Time) {
+	for {
+		children, _, event, err := z.zkConn.ChildrenW(p)
+		if err == nil {
+			set(children)
+			return event, nil
+		}
+		if errors.Is(err, zk.ErrNoNode) {
+			set([]string{})
+		}
+		if !optional || !errors.Is(err, zk.ErrNoNode) {
+			z.logger.Warn("watch zookeeper children failed", "path", p, "retryAfter", bookieWatchRetryInterval, "error", err)
+			return nil, time.After(bookieWatchRetryInterval)
+		}
+
+		exists, _, event, err := z.zkConn.ExistsW(p)
+		if err != nil {
+			z.logger.Warn("watch zookeeper node failed", "path", p, "retryAfter", bookieWatchRetryInterval, "error", err)
+			return nil, time.After(bookieWatchRetryInterval)
+		}
+		if !exists {
+			return event, nil
+		}
+		// the path is created meanwhile, read its children
+	}
+}
+
+// zkEventWatch keep watching bookies, the watch is armed again after every
+// event, and after reconnecting as changes may be missed while disconnected.
+// The connection establishes a new session by itself once the session
+// expired, the watches lost with the old session are registered again.
+func (z *Zookeeper) zkEventWatch(zkCh, bkCh, roCh <-chan zk.Event, roRetry <-chan time.Time) {
+	defer z.wg.Done()
+
+	var retry <-chan time.Time
 	for {
 		select {
+		case <-z.done:
+			return
+
 		case ev, ok := <-zkCh:
 			if !ok {
 				return
 			}
-			fmt.Println("zookeeper event:", ev)
-
-		case ev, ok := <-bkCh:
-			if !ok {
-				return
+			z.logger.Debug("zookeeper event", "type", ev.Type, "state", ev.State, "server", ev.Server)
+			if ev.Type != zk.EventSession {
+				continue
+			}
+			switch ev.State {
+			case zk.StateExpired:
+				z.setSessionExpired(true)
+			case zk.StateHasSession:
+				bkCh, retry = z.watchBookies()
+				roCh, roRetry = z.watchReadOnlyBookies()
+				z.setSessionExpired(false)
 			}
-			fmt.Println("bookie event:", ev)
+
+		case ev := <-bkCh:
+			z.logger.Debug("bookie event", "type", ev.Type, "path", ev.Path)
+			bkCh, retry = z.watchBookies()
+
+		case <-retry:
+			bkCh, retry = z.watchBookies()
+
+		case ev := <-roCh:
+			z.logger.Debug("read only bookie event", "type", ev.Type, "path", ev.Path)
+			roCh, roRetry = z.watchReadOnlyBookies()
+
+		case <-roRetry:
+			roCh, roRetry = z.watchReadOnlyBookies()
 		}
 	}
 }
@@ -1,10 +1,15 @@
 package bookkeeper
 
 import (
+	"context"
 	"fmt"
+	"path"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/go-zookeeper/zk"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -27,7 +32,287 @@ func TestZkLedger(t *testing.T) {
 	})
 	assert.NoError(t, err)
 
-	ledger, err := zk.LedgerID()
+	ledger, err := zk.LedgerID(context.Background())
 	assert.NoError(t, err)
 	fmt.Println(ledger)
 }
+
+// memoryZk is an in memory zkConn for tests
+type memoryZk struct {
+	lock     sync.Mutex
+	closed   bool
+	seq      int64
+	nodes    map[string]*memoryZnode
+	watchers map[string][]chan zk.Event
+
+	nodeWatchers map[string][]chan zk.Event
+}
+
+type memoryZnode struct {
+	data    []byte
+	version int32
+}
+
+func newMemoryZk() *memoryZk {
+	return &memoryZk{
+		nodes:    make(map[string]*memoryZnode),
+		watchers: make(map[string][]chan zk.Event),
+
+		nodeWatchers: make(map[string][]chan zk.Event),
+	}
+}
+
+func (m *memoryZk) Create(p string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return "", zk.ErrClosing
+	}
+	if flags&zk.FlagSequence != 0 {
+		m.seq++
+		p = fmt.Sprintf("%s%010d", p, m.seq)
+	}
+	if _, ok := m.nodes[p]; ok {
+		return "", zk.ErrNodeExists
+	}
+
+	m.nodes[p] = &memoryZnode{data: data}
+	m.fireNodeWatch(p, zk.EventNodeCreated)
+	m.fireChildWatch(path.Dir(p))
+	return p, nil
+}
+
+func (m *memoryZk) Get(p string) ([]byte, *zk.Stat, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return nil, nil, zk.ErrClosing
+	}
+	node, ok := m.nodes[p]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	return node.data, &zk.Stat{Version: node.version}, nil
+}
+
+func (m *memoryZk) Set(p string, data []byte, version int32) (*zk.Stat, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return nil, zk.ErrClosing
+	}
+	node, ok := m.nodes[p]
+	if !ok {
+		return nil, zk.ErrNoNode
+	}
+	if version != -1 && version != node.version {
+		return nil, zk.ErrBadVersion
+	}
+
+	node.data = data
+	node.version++
+	return &zk.Stat{Version: node.version}, nil
+}
+
+func (m *memoryZk) Delete(p string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.nodes, p)
+	m.fireNodeWatch(p, zk.EventNodeDeleted)
+	m.fireChildWatch(path.Dir(p))
+}
+
+func (m *memoryZk) ChildrenW(p string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	children := make([]string, 0)
+	for nodePath := range m.nodes {
+		if path.Dir(nodePath) == p {
+			children = append(children, path.Base(nodePath))
+		}
+	}
+	sort.Strings(children)
+
+	// parents of created nodes exist implicitly
+	if _, ok := m.nodes[p]; !ok && len(children) == 0 {
+		return nil, nil, nil, zk.ErrNoNode
+	}
+
+	ch := make(chan zk.Event, 1)
+	m.watchers[p] = append(m.watchers[p], ch)
+	return children, &zk.Stat{}, ch, nil
+}
+
+func (m *memoryZk) ExistsW(p string) (bool, *zk.Stat, <-chan zk.Event, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return false, nil, nil, zk.ErrClosing
+	}
+	ch := make(chan zk.Event, 1)
+	m.nodeWatchers[p] = append(m.nodeWatchers[p], ch)
+
+	node, ok := m.nodes[p]
+	if !ok {
+		return false, nil, ch, nil
+	}
+	return true, &zk.Stat{Version: node.version}, ch, nil
+}
+
+func (m *memoryZk) Close() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.closed = true
+}
+
+func (m *memoryZk) fireChildWatch(p string) {
+	for _, ch := range m.watchers[p] {
+		ch <- zk.Event{Type: zk.EventNodeChildrenChanged, Path: p}
+	}
+	delete(m.watchers, p)
+}
+
+func (m *memoryZk) fireNodeWatch(p string, eventType zk.EventType) {
+	for _, ch := range m.nodeWatchers[p] {
+		ch <- zk.Event{Type: eventType, Path: p}
+	}
+	delete(m.nodeWatchers, p)
+}
+
+// newMemoryZookeeper return Zookeeper on memoryZk with the bookies available
+func newMemoryZookeeper(bookies ...string) (*Zookeeper, *memoryZk) {
+	conn := newMemoryZk()
+	conn.Create("/ledgers/available", nil, 0, nil)
+	for _, bookie := range bookies {
+		conn.Create(path.Join("/ledgers/available", bookie), nil, 0, nil)
+	}
+
+	z, err := newZookeeper(conn, nil, "/ledgers", nopLogger{})
+	if err != nil {
+		panic(err)
+	}
+	return z, conn
+}
+
+func TestZookeeperClose(t *testing.T) {
+	z, conn := newMemoryZookeeper(testBookies(3)...)
+	assert.NoError(t, z.Close())
+	assert.NoError(t, z.Close())
+
+	_, err := z.LedgerID(context.Background())
+	assert.ErrorIs(t, err, zk.ErrClosing)
+	assert.True(t, conn.closed)
+}
+
+func TestZookeeperWatchBookies(t *testing.T) {
+	z, conn := newMemoryZookeeper(testBookies(3)...)
+	defer z.Close()
+
+	type change struct{ joined, left []string }
+	changes := make(chan change, 10)
+	cancel := z.WatchBookies(func(joined, left []string) {
+		changes <- change{joined, left}
+	})
+
+	// the watch is armed again after every event
+	for i := 0; i < 3; i++ {
+		bookie := fmt.Sprintf("127.0.0.1:%d", 9000+i)
+		conn.Create(path.Join("/ledgers/available", bookie), nil, 0, nil)
+		assert.Equal(t, change{joined: []string{bookie}}, <-changes)
+		assert.Contains(t, z.Bookies(), bookie)
+	}
+
+	conn.Delete("/ledgers/available/127.0.0.1:8000")
+	assert.Equal(t, change{left: []string{"127.0.0.1:8000"}}, <-changes)
+	assert.NotContains(t, z.Bookies(), "127.0.0.1:8000")
+	assert.Len(t, z.Bookies(), 5)
+
+	cancel()
+	conn.Delete("/ledgers/available/127.0.0.1:8001")
+	assert.Eventually(t, func() bool { return len(z.Bookies()) == 4 }, time.Second, time.Millisecond)
+	assert.Empty(t, changes)
+}
+
+func TestZookeeperWatchBookiesReconnect(t *testing.T) {
+	conn := newMemoryZk()
+	conn.Create("/ledgers/available/127.0.0.1:8000", nil, 0, nil)
+
+	evCh := make(chan zk.Event, 1)
+	z, err := newZookeeper(conn, evCh, "/ledgers", nopLogger{})
+	assert.NoError(t, err)
+	defer z.Close()
+
+	// the change is missed while disconnected, it's read after reconnecting
+	conn.lock.Lock()
+	conn.nodes["/ledgers/available/127.0.0.1:8001"] = &memoryZnode{}
+	conn.lock.Unlock()
+
+	evCh <- zk.Event{Type: zk.EventSession, State: zk.StateHasSession}
+	assert.Eventually(t, func() bool { return len(z.Bookies()) == 2 }, time.Second, time.Millisecond)
+}
+
+func TestZookeeperReadOnlyBookies(t *testing.T) {
+	conn := newMemoryZk()
+	for _, bookie := range testBookies(3) {
+		conn.Create(path.Join("/ledgers/available", bookie), nil, 0, nil)
+	}
+	logger := &recordLogger{}
+	z, err := newZookeeper(conn, nil, "/ledgers", logger)
+	assert.NoError(t, err)
+	defer z.Close()
+	assert.Empty(t, z.ReadOnlyBookies())
+
+	// the read only path doesn't exist yet, it's watched to be created
+	conn.lock.Lock()
+	assert.Len(t, conn.nodeWatchers["/ledgers/available/readonly"], 1)
+	conn.lock.Unlock()
+
+	// the bookie moves to read only when its disks are full
+	conn.Create("/ledgers/available/readonly", nil, 0, nil)
+	conn.Create("/ledgers/available/readonly/127.0.0.1:8000", nil, 0, nil)
+	conn.Delete("/ledgers/available/127.0.0.1:8000")
+	assert.Eventually(t, func() bool {
+		return len(z.ReadOnlyBookies()) == 1 && len(z.Bookies()) == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"127.0.0.1:8000"}, z.ReadOnlyBookies())
+	assert.NotContains(t, z.Bookies(), "readonly")
+
+	conn.Delete("/ledgers/available/readonly/127.0.0.1:8000")
+	assert.Eventually(t, func() bool { return len(z.ReadOnlyBookies()) == 0 }, time.Second, time.Millisecond)
+	_, warned := logger.find("watch zookeeper children failed")
+	assert.False(t, warned)
+}
+
+func TestZookeeperSessionExpired(t *testing.T) {
+	conn := newMemoryZk()
+	conn.Create("/ledgers/available/127.0.0.1:8000", nil, 0, nil)
+
+	evCh := make(chan zk.Event, 1)
+	z, err := newZookeeper(conn, evCh, "/ledgers", nopLogger{})
+	assert.NoError(t, err)
+	defer z.Close()
+
+	notified := make(chan bool, 2)
+	z.WatchSession(func(expired bool) { notified <- expired })
+
+	evCh <- zk.Event{Type: zk.EventSession, State: zk.StateExpired}
+	assert.True(t, <-notified)
+	assert.True(t, z.SessionExpired())
+
+	// the bookie joined while the session was lost is seen with the new session
+	conn.lock.Lock()
+	conn.nodes["/ledgers/available/127.0.0.1:8001"] = &memoryZnode{}
+	conn.lock.Unlock()
+
+	evCh <- zk.Event{Type: zk.EventSession, State: zk.StateHasSession}
+	assert.False(t, <-notified)
+	assert.False(t, z.SessionExpired())
+	assert.Len(t, z.Bookies(), 2)
+}